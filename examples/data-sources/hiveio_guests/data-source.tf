@@ -0,0 +1,8 @@
+data "hiveio_guests" "desktops" {
+  pool_id = hiveio_guest_pool.desktops.id
+  state   = "ready"
+}
+
+output "desktop_ips" {
+  value = data.hiveio_guests.desktops.guests[*].ip_address
+}
@@ -0,0 +1,7 @@
+data "hiveio_networks" "host" {
+  host_id = hiveio_host.host1.id
+}
+
+output "production_vlan" {
+  value = [for n in data.hiveio_networks.host.networks : n.vlan if n.role == "production"][0]
+}
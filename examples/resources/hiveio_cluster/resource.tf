@@ -0,0 +1,12 @@
+resource "hiveio_cluster" "cluster" {
+  broker {
+    title                     = "Desktops"
+    disclaimer                = "Authorized users only"
+    hide_release              = true
+    auto_connect_user_desktop = true
+  }
+  backup {
+    start_window = "01:00:00"
+    end_window   = "05:00:00"
+  }
+}
@@ -21,6 +21,9 @@ resource "hiveio_disk" "ubuntu" {
   filename     = "ubuntu.qcow2"
   storage_pool = storage_pool_id
   src_url      = "https://cloud-images.ubuntu.com/bionic/current/bionic-server-cloudimg-amd64.img"
+
+  # replaced when the published image changes
+  source_checksum = "sha256:https://cloud-images.ubuntu.com/bionic/current/SHA256SUMS"
 }
 
 #Upload a file to a storage pool
@@ -0,0 +1,7 @@
+resource "hiveio_guest" "alice" {
+  name            = "DESK1"
+  assigned_user   = "alice"
+  realm           = hiveio_realm.test.name
+  host_id         = hiveio_host.host1.id
+  rebuild_trigger = "2024-01"
+}
@@ -19,24 +19,28 @@ resource "hiveio_profile" "test" {
     size       = 10
   }
   broker_options {
-    allow_desktop_composition   = true
-    audio_capture               = true
-    disable_full_window_drag    = false
-    disable_menu_anims          = false
-    disable_printer             = false
-    disable_themes              = false
-    disable_wallpaper           = false
-    hide_authentication_failure = true
-    inject_password             = false
-    credssp                     = true
-    redirect_clipboard          = true
-    redirect_disk               = true
-    redirect_pnp                = true
-    redirect_printer            = true
-    redirect_smartcard          = false
-    redirect_usb                = true
-    smart_resize                = true
-    fail_on_cert_mismatch       = false
-    html5                       = true
+    rdp {
+      allow_desktop_composition   = true
+      audio_capture               = true
+      disable_full_window_drag    = false
+      disable_menu_anims          = false
+      disable_printer             = false
+      disable_themes              = false
+      disable_wallpaper           = false
+      hide_authentication_failure = true
+      inject_password             = false
+      credssp                     = true
+      redirect_clipboard          = true
+      redirect_disk               = true
+      redirect_pnp                = true
+      redirect_printer            = true
+      redirect_smartcard          = false
+      redirect_usb                = true
+      smart_resize                = true
+      fail_on_cert_mismatch       = false
+    }
+    html5 {
+      enabled = true
+    }
   }
 }
\ No newline at end of file
@@ -6,4 +6,6 @@ resource "hiveio_realm" "home" {
   fqdn     = "test.test-domain.net"
   username = var.realm_user
   password = var.realm_password
+
+  verify_on_apply = true
 }
\ No newline at end of file
@@ -31,10 +31,11 @@ resource "hiveio_profile" "test_profile" {
   name     = "test"
   timezone = "disabled"
   ad_config {
-    domain     = hiveio_realm.test.name
-    username   = "serviceAccount"
-    password   = "Password123"
-    user_group = "Users"
+    domain           = hiveio_realm.test.name
+    username         = "serviceAccount"
+    password         = "Password123"
+    password_version = 1
+    user_group       = "Users"
   }
   user_volumes {
     repository      = hiveio_storage_pool.uvs.id
@@ -4,10 +4,10 @@ go 1.13
 
 require (
 	github.com/aws/aws-sdk-go v1.28.1 // indirect
-	github.com/eventials/go-tus v0.0.0-20211022131811-252c8454f2dc // indirect
+	github.com/eventials/go-tus v0.0.0-20211022131811-252c8454f2dc
 	github.com/go-test/deep v1.0.7 // indirect
 	github.com/google/uuid v1.1.2
-	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/gorilla/websocket v1.5.0
 	github.com/hashicorp/go-uuid v1.0.2 // indirect
 	github.com/hashicorp/go-version v1.4.0 // indirect
 	github.com/hashicorp/hcl/v2 v2.6.0 // indirect
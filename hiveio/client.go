@@ -0,0 +1,450 @@
+package hiveio
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eventials/go-tus"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+const (
+	maxRetries     = 5
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+
+	uploadChunkSize = 2 * 1024 * 1024
+)
+
+// hiveClient is the provider meta object passed to every resource. It keeps
+// the login credentials so the session can be renewed when the token expires.
+type hiveClient struct {
+	host     string
+	port     uint
+	insecure bool
+	username string
+	password string
+	realm    string
+
+	httpClient *http.Client
+	uploads    *uploadStore
+
+	mu      sync.Mutex
+	client  *rest.Client
+	token   string
+	session uint64
+}
+
+func newHiveClient(host string, port uint, insecure bool, username, password, realm string) (*hiveClient, error) {
+	c := &hiveClient{
+		host:     host,
+		port:     port,
+		insecure: insecure,
+		username: username,
+		password: password,
+		realm:    realm,
+		httpClient: &http.Client{
+			Transport: &loggingTransport{
+				next: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+				},
+			},
+			Timeout: 120 * time.Second,
+		},
+		uploads: newUploadStore(),
+	}
+	if err := c.login(0); err != nil {
+		return nil, classifyError(err)
+	}
+	return c, nil
+}
+
+// current returns the rest client for the active session.
+func (c *hiveClient) current() (*rest.Client, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client, c.session
+}
+
+// login starts a new session unless the session that failed has already been
+// replaced. Callers that fail at the same time wait on the lock and reuse the
+// session created by the first one.
+func (c *hiveClient) login(session uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session != session {
+		return nil
+	}
+	client := &rest.Client{Host: c.host, Port: c.port, AllowInsecure: c.insecure}
+	// the token is requested here instead of with client.Login so that
+	// uploads can use it, the rest client does not expose its token
+	token := ""
+	if c.password != "" || (c.host != "localhost" && c.host != "::1" && c.host != "127.0.0.1") {
+		var auth struct {
+			Token string `json:"token"`
+		}
+		credentials := map[string]string{"username": c.username, "password": c.password, "realm": c.realm}
+		if err := c.do(context.Background(), "", "POST", "auth", credentials, &auth); err != nil {
+			return err
+		}
+		token = auth.Token
+	}
+	client.SetToken(token)
+	c.client = client
+	c.token = token
+	c.session++
+	return nil
+}
+
+// do sends a single request and decodes the json response into result.
+// Errors have the same format as the errors of the rest client so they can be
+// classified the same way.
+func (c *hiveClient) do(ctx context.Context, token, method, path string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.url("api/"+path), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("{\"error\": %d, \"message\": %s}", res.StatusCode, resBody)
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if result == nil || len(resBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resBody, result)
+}
+
+// call runs fn with the rest client for the active session. When the session
+// has expired it logs in again and replays fn, server errors and dropped
+// connections are retried with exponential backoff. fn must only send
+// idempotent requests (GET, PUT, DELETE), use callOnce for anything else.
+// endpoint names the request fn sends, like "GET guest/DESK1", every attempt
+// is logged with it.
+func (c *hiveClient) call(ctx context.Context, endpoint string, fn func(*rest.Client) error) error {
+	return c.retry(ctx, endpoint, fn, isRetryable)
+}
+
+// callOnce runs fn like call, but only retries requests that failed before
+// they were sent. It is used for POST requests that create objects or start
+// actions, a server error could have happened after the server committed
+// them and a retry would repeat them.
+func (c *hiveClient) callOnce(ctx context.Context, endpoint string, fn func(*rest.Client) error) error {
+	return c.retry(ctx, endpoint, fn, isNotSent)
+}
+
+func (c *hiveClient) retry(ctx context.Context, endpoint string, fn func(*rest.Client) error, retryable func(error) bool) error {
+	backoff := initialBackoff
+	relogin := false
+	for attempt := 0; ; attempt++ {
+		client, session := c.current()
+		start := time.Now()
+		err := classifyError(fn(client))
+		logCall(endpoint, attempt, time.Since(start), err)
+		switch {
+		case err == nil:
+			return nil
+		case isUnauthorized(err) && !relogin:
+			log.Printf("[INFO] Session expired, logging in to %s again", c.host)
+			relogin = true
+			if loginErr := c.login(session); loginErr != nil {
+				return classifyError(loginErr)
+			}
+			continue
+		case retryable(err) && attempt < maxRetries:
+			log.Printf("[WARN] %s to %s failed, retrying in %s: %s", endpoint, c.host, backoff, err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// isRetryable reports whether a request can be sent again after a delay.
+func isRetryable(err error) bool {
+	if errors.Is(classifyError(err), errServerError) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	return isNotSent(err) || strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// isNotSent reports whether a request failed because no connection to the
+// server could be opened, so the server never received it.
+func isNotSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+func (c *hiveClient) url(path string) string {
+	protocol := "https"
+	if c.port == 3000 {
+		protocol = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d/%s", protocol, c.host, c.port, path)
+}
+
+// download streams a file from a storage pool into w, w is reset before
+// every attempt. Downloads require Hive Fabric 8.5 or newer.
+func (c *hiveClient) download(ctx context.Context, storageID, filename string, w resetWriter) error {
+	storage := rest.StoragePool{ID: storageID}
+	endpoint := "GET storage/pool/" + storageID + "/download?filePath=" + url.QueryEscape(filename)
+	return c.call(ctx, endpoint, func(client *rest.Client) error {
+		w.Reset()
+		res, err := storage.Download(client, filename)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		// the rest client sends the download without a context, closing the
+		// body stops it when ctx is cancelled
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				res.Body.Close()
+			case <-done:
+			}
+		}()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(res.Body)
+			return fmt.Errorf("{\"error\": %d, \"message\": %s}", res.StatusCode, body)
+		}
+		if _, err := io.Copy(w, res.Body); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// resetWriter is a writer that can be emptied, like a hash or a buffer.
+type resetWriter interface {
+	io.Writer
+	Reset()
+}
+
+// upload copies a local file into a storage pool with the tus protocol.
+// Failed uploads are resumed from the last offset the server acknowledged.
+func (c *hiveClient) upload(ctx context.Context, storageID, localFile, filename string) error {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	upload, err := tus.NewUploadFromFile(f)
+	if err != nil {
+		return err
+	}
+	upload.Metadata["storageId"] = storageID
+	upload.Metadata["filename"] = filename
+	upload.Fingerprint = c.host + "/" + storageID + "/" + filename + "/" + upload.Fingerprint
+
+	backoff := initialBackoff
+	relogin := false
+	for attempt := 0; ; attempt++ {
+		c.mu.Lock()
+		token, session := c.token, c.session
+		c.mu.Unlock()
+		err := c.uploadChunks(ctx, upload, token)
+		var clientErr tus.ClientError
+		switch {
+		case err == nil:
+			c.uploads.Delete(upload.Fingerprint)
+			return nil
+		case errors.As(err, &clientErr) && clientErr.Code == http.StatusUnauthorized && !relogin:
+			log.Printf("[INFO] Session expired, logging in to %s again", c.host)
+			relogin = true
+			if loginErr := c.login(session); loginErr != nil {
+				return classifyError(loginErr)
+			}
+			continue
+		case isUploadRetryable(err) && attempt < maxRetries:
+			log.Printf("[WARN] Upload of %s failed at %d of %d bytes, resuming in %s: %s", localFile, upload.Offset(), upload.Size(), backoff, err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		return err
+	}
+}
+
+func (c *hiveClient) uploadChunks(ctx context.Context, upload *tus.Upload, token string) error {
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+token)
+	tusClient, err := tus.NewClient(c.url("upload/"), &tus.Config{
+		ChunkSize:  uploadChunkSize,
+		Resume:     true,
+		Store:      c.uploads,
+		Header:     header,
+		HttpClient: c.httpClient,
+	})
+	if err != nil {
+		return err
+	}
+	uploader, err := tusClient.CreateOrResumeUpload(upload)
+	if err != nil {
+		return err
+	}
+	if uploader.Offset() > 0 {
+		log.Printf("[INFO] Resuming upload of %s at %d of %d bytes", upload.Metadata["filename"], uploader.Offset(), upload.Size())
+	}
+	for uploader.Offset() < upload.Size() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := uploader.UploadChunck(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isUploadRetryable reports whether an upload can be resumed after a delay.
+func isUploadRetryable(err error) bool {
+	var clientErr tus.ClientError
+	if errors.As(err, &clientErr) {
+		return clientErr.Code >= 500
+	}
+	return errors.Is(err, tus.ErrOffsetMismatch) || isRetryable(err)
+}
+
+// uploadStore remembers the upload urls for tus so failed uploads can be
+// resumed, also by a later terraform run. Every url is saved in a file in
+// dir named after the hash of the upload fingerprint. Without a dir the urls
+// are only kept in memory. It is shared by all resources of the provider.
+type uploadStore struct {
+	dir  string
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+func newUploadStore() *uploadStore {
+	s := &uploadStore{urls: map[string]string{}}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		log.Printf("[WARN] Failed uploads can only be resumed by the same run: %s", err)
+		return s
+	}
+	s.dir = filepath.Join(cacheDir, "terraform-provider-hiveio", "uploads")
+	return s
+}
+
+func (s *uploadStore) path(fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *uploadStore) Get(fingerprint string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if url, ok := s.urls[fingerprint]; ok {
+		return url, true
+	}
+	if s.dir == "" {
+		return "", false
+	}
+	data, err := ioutil.ReadFile(s.path(fingerprint))
+	if err != nil {
+		return "", false
+	}
+	url := strings.TrimSpace(string(data))
+	if url == "" {
+		return "", false
+	}
+	s.urls[fingerprint] = url
+	return url, true
+}
+
+func (s *uploadStore) Set(fingerprint, url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[fingerprint] = url
+	if s.dir == "" {
+		return
+	}
+	err := os.MkdirAll(s.dir, 0700)
+	if err == nil {
+		err = ioutil.WriteFile(s.path(fingerprint), []byte(url), 0600)
+	}
+	if err != nil {
+		log.Printf("[WARN] Failed to save the upload url, the upload can only be resumed by the same run: %s", err)
+	}
+}
+
+func (s *uploadStore) Delete(fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.urls, fingerprint)
+	if s.dir == "" {
+		return
+	}
+	if err := os.Remove(s.path(fingerprint)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] Failed to remove the saved upload url: %s", err)
+	}
+}
+
+// Close does nothing, every url is saved when it is set.
+func (s *uploadStore) Close() {}
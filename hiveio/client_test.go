@@ -0,0 +1,154 @@
+package hiveio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestClientReauthenticates(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addStoragePool("vms")
+	client := testClient(t, fake)
+
+	fake.expireSession()
+	err := client.call(context.Background(), "GET storage/pools?name=vms", func(c *rest.Client) error {
+		_, err := c.GetStoragePoolByName("vms")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.loginCount(); count != 2 {
+		t.Fatalf("expected 2 logins, got %d", count)
+	}
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	client := testClient(t, fake)
+
+	fake.failNext("GET", "storage/pool/"+storage.ID, 503, "Service Unavailable")
+	err := client.call(context.Background(), "GET storage/pool/"+storage.ID, func(c *rest.Client) error {
+		_, err := c.GetStoragePool(storage.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := fake.requestCount("GET", "storage/pool/"+storage.ID); count != 2 {
+		t.Fatalf("expected 2 requests, got %d", count)
+	}
+}
+
+func TestClientDoesNotRetryCreates(t *testing.T) {
+	fake := newFakeHive(t)
+	client := testClient(t, fake)
+
+	fake.failNext("POST", "storage/pools", 503, "Service Unavailable")
+	err := client.callOnce(context.Background(), "POST storage/pools", func(c *rest.Client) error {
+		storage := rest.StoragePool{Name: "vms", Type: "nfs", Server: "10.0.0.1", Path: "/vms"}
+		_, err := storage.Create(c)
+		return err
+	})
+	if !errors.Is(err, errServerError) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+	if count := fake.requestCount("POST", "storage/pools"); count != 1 {
+		t.Fatalf("expected 1 request, got %d", count)
+	}
+}
+
+func TestClientDoesNotRetryNotFound(t *testing.T) {
+	fake := newFakeHive(t)
+	client := testClient(t, fake)
+
+	err := client.call(context.Background(), "GET storage/pool/missing", func(c *rest.Client) error {
+		_, err := c.GetStoragePool("missing")
+		return err
+	})
+	if !isNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if count := fake.requestCount("GET", "storage/pool/missing"); count != 1 {
+		t.Fatalf("expected 1 request, got %d", count)
+	}
+}
+
+func TestClientDownloadReauthenticates(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	fake.addDisk(storage.ID, "ubuntu.qcow2", "qcow2", 20)
+	fake.update(func() { fake.contents[storage.ID+"/ubuntu.qcow2"] = []byte("image") })
+	client := testClient(t, fake)
+
+	fake.expireSession()
+	var buf bytes.Buffer
+	if err := client.download(context.Background(), storage.ID, "ubuntu.qcow2", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "image" {
+		t.Fatalf("expected the disk contents, got %q", buf.String())
+	}
+	if count := fake.loginCount(); count != 2 {
+		t.Fatalf("expected 2 logins, got %d", count)
+	}
+	// the expired session is found by the version check before the download
+	if count := fake.requestCount("GET", "host/version"); count != 2 {
+		t.Fatalf("expected 2 version checks, got %d", count)
+	}
+	if count := fake.requestCount("GET", "storage/pool/"+storage.ID+"/download"); count != 1 {
+		t.Fatalf("expected 1 download, got %d", count)
+	}
+
+	err := client.download(context.Background(), storage.ID, "missing.qcow2", &buf)
+	if !isNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestClientUploadResumesAfterRestart(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	data := bytes.Repeat([]byte("hive"), 5*1024*1024/4)
+	f, err := ioutil.TempFile("", "disk*.qcow2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	f.Write(data)
+	f.Close()
+
+	// the first run gives up while it waits to retry the second chunk
+	fake.update(func() { fake.failUploadChunks = 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := testClient(t, fake).upload(ctx, storage.ID, f.Name(), "upload.qcow2"); err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+
+	if err := testClient(t, fake).upload(context.Background(), storage.ID, f.Name(), "upload.qcow2"); err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	var contents []byte
+	fake.update(func() {
+		offsets = fake.uploadOffsets
+		contents = fake.contents[storage.ID+"/upload.qcow2"]
+	})
+	if !bytes.Equal(contents, data) {
+		t.Fatalf("uploaded %d of %d bytes", len(contents), len(data))
+	}
+	expected := []int64{0, uploadChunkSize, uploadChunkSize, 2 * uploadChunkSize}
+	if fmt.Sprint(offsets) != fmt.Sprint(expected) {
+		t.Fatalf("expected the upload to resume, chunks were sent at %v", offsets)
+	}
+}
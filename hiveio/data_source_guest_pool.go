@@ -0,0 +1,51 @@
+package hiveio
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func dataSourceGuestPool() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceGuestPool(), "wait_for_build", "rolling_update", "max_unavailable")
+	s["id"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+	s["name"].Optional = true
+	return &schema.Resource{
+		Description: "The guest pool data source can be used to retrieve settings from an existing guest pool.",
+		ReadContext: dataSourceGuestPoolRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceGuestPoolRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var pool *rest.Pool
+	var err error
+
+	id, idOk := d.GetOk("id")
+	name, nameOk := d.GetOk("name")
+	if idOk {
+		err = client.call(ctx, "GET pool/"+id.(string), func(c *rest.Client) (err error) {
+			pool, err = c.GetPool(id.(string))
+			return err
+		})
+	} else if nameOk {
+		err = client.call(ctx, "GET pools?name="+name.(string), func(c *rest.Client) (err error) {
+			pool, err = c.GetPoolByName(name.(string))
+			return err
+		})
+	} else {
+		return diag.Errorf("id or name must be provided")
+	}
+
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(pool.ID)
+	return resourceGuestPoolRead(ctx, d, m)
+}
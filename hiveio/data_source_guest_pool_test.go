@@ -0,0 +1,56 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestDataSourceGuestPool(t *testing.T) {
+	fake, profile := testGuestPoolFake(t)
+	fake.update(func() {
+		fake.pools["pool1"] = &rest.Pool{
+			ID:          "pool1",
+			Name:        "desktops",
+			Type:        "vdi",
+			Seed:        "DESK",
+			ProfileID:   profile.ID,
+			StorageType: "disk",
+			StorageID:   "disk",
+			Density:     []int{2, 4},
+			GuestProfile: &rest.PoolGuestProfile{
+				TemplateName: "win10",
+				CPU:          []int{2, 2},
+				Mem:          []int{4096, 4096},
+			},
+			Backup: &rest.PoolBackup{Enabled: true, Frequency: "daily", TargetStorageID: "backup"},
+		}
+	})
+
+	for _, config := range []map[string]interface{}{
+		{"id": "pool1"},
+		{"name": "desktops"},
+	} {
+		state, err := testReadDataSource(t, fake, "hiveio_guest_pool", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resource.ComposeTestCheckFunc(
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "id", "pool1"),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "name", "desktops"),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "template", "win10"),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "profile", profile.ID),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "density.1", "4"),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "memory", "4096"),
+			resource.TestCheckResourceAttr("data.hiveio_guest_pool.test", "backup.0.frequency", "daily"),
+		)(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := testReadDataSource(t, fake, "hiveio_guest_pool", map[string]interface{}{"id": "unknown"}); err == nil {
+		t.Fatal("expected an error for an unknown pool")
+	}
+}
@@ -0,0 +1,148 @@
+package hiveio
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func dataSourceGuests() *schema.Resource {
+	return &schema.Resource{
+		Description: "The guests data source can be used to list guests matching all of the given filters.",
+		ReadContext: dataSourceGuestsRead,
+		Schema: map[string]*schema.Schema{
+			"pool_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"host_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"state": {
+				Description: "The guest state, for example `ready` or `stopped`.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"username": {
+				Description: "The user the guests are assigned to.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"name_regex": {
+				Description:  "A regular expression the guest names must match.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"guests": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"state": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"ip_address": {
+							Description: "The first ip address reported by the guest agent.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"ip_addresses": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"username": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"realm": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"host_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"pool_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceGuestsRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	query := url.Values{}
+	for attr, field := range map[string]string{
+		"pool_id":  "poolId",
+		"host_id":  "hostid",
+		"state":    "guestState",
+		"username": "username",
+	} {
+		if v, ok := d.GetOk(attr); ok {
+			query.Set(field, v.(string))
+		}
+	}
+	var nameRegex *regexp.Regexp
+	if v, ok := d.GetOk("name_regex"); ok {
+		nameRegex = regexp.MustCompile(v.(string))
+	}
+
+	var guests []rest.Guest
+	err := client.call(ctx, "GET guests?"+query.Encode(), func(c *rest.Client) (err error) {
+		guests, err = c.ListGuests(query.Encode())
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	sort.Slice(guests, func(i, j int) bool { return guests[i].Name < guests[j].Name })
+
+	var result []interface{}
+	for i := range guests {
+		guest := &guests[i]
+		if nameRegex != nil && !nameRegex.MatchString(guest.Name) {
+			continue
+		}
+		var ipAddresses []string
+		for _, iface := range guest.Interfaces {
+			if iface.IPAddress != "" {
+				ipAddresses = append(ipAddresses, iface.IPAddress)
+			}
+		}
+		result = append(result, map[string]interface{}{
+			"name":         guest.Name,
+			"state":        guest.GuestState,
+			"ip_address":   guestIPAddress(guest),
+			"ip_addresses": ipAddresses,
+			"username":     guest.Username,
+			"realm":        guest.Realm,
+			"host_id":      guest.Hostid,
+			"pool_id":      guest.PoolID,
+		})
+	}
+
+	d.SetId(strconv.Itoa(schema.HashString(query.Encode() + d.Get("name_regex").(string))))
+	d.Set("guests", result)
+	return diag.Diagnostics{}
+}
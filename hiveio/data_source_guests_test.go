@@ -0,0 +1,75 @@
+package hiveio
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestDataSourceGuests(t *testing.T) {
+	fake := newFakeHive(t)
+	host := fake.addHost("10.0.0.11")
+	fake.update(func() {
+		fake.pools["pool1"] = &rest.Pool{ID: "pool1", Name: "pool1", Seed: "DESK", Density: []int{3, 3}, GuestProfile: &rest.PoolGuestProfile{
+			Interfaces: []*rest.PoolInterface{{Network: "prod", Vlan: 10}},
+		}}
+		fake.buildGuests(fake.pools["pool1"])
+		fake.guests["DESK2"].GuestState = "stopped"
+		fake.guests["DESK3"].Username = "alice"
+		fake.guests["DESK3"].Realm = "example"
+		fake.guests["OTHER"] = &rest.Guest{Name: "OTHER", GuestState: "ready", Hostid: host.Hostid}
+	})
+
+	tests := []struct {
+		config map[string]interface{}
+		names  []string
+	}{
+		{map[string]interface{}{}, []string{"DESK1", "DESK2", "DESK3", "OTHER"}},
+		{map[string]interface{}{"pool_id": "pool1"}, []string{"DESK1", "DESK2", "DESK3"}},
+		{map[string]interface{}{"pool_id": "pool1", "state": "ready"}, []string{"DESK1", "DESK3"}},
+		{map[string]interface{}{"username": "alice"}, []string{"DESK3"}},
+		{map[string]interface{}{"host_id": host.Hostid, "name_regex": "^OTH"}, []string{"OTHER"}},
+		{map[string]interface{}{"host_id": "unknown"}, nil},
+	}
+	for _, tc := range tests {
+		state, err := testReadDataSource(t, fake, "hiveio_guests", tc.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks := []resource.TestCheckFunc{
+			resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.#", strconv.Itoa(len(tc.names))),
+		}
+		for i, name := range tc.names {
+			checks = append(checks, resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests."+strconv.Itoa(i)+".name", name))
+		}
+		if err := resource.ComposeTestCheckFunc(checks...)(state); err != nil {
+			t.Fatalf("%v: %s", tc.config, err)
+		}
+	}
+
+	var ip string
+	fake.update(func() { ip = fake.guests["DESK3"].Interfaces[0].IPAddress })
+	if ip == "" {
+		t.Fatal("expected the fake to assign an ip address to DESK3")
+	}
+	state, err := testReadDataSource(t, fake, "hiveio_guests", map[string]interface{}{"username": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.ComposeTestCheckFunc(
+		resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.0.ip_address", ip),
+		resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.0.ip_addresses.0", ip),
+		resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.0.realm", "example"),
+		resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.0.pool_id", "pool1"),
+		resource.TestCheckResourceAttr("data.hiveio_guests.test", "guests.0.host_id", host.Hostid),
+	)(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testReadDataSource(t, fake, "hiveio_guests", map[string]interface{}{"name_regex": "("}); err == nil {
+		t.Fatal("expected an error for an invalid name_regex")
+	}
+}
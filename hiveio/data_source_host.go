@@ -38,19 +38,27 @@ func dataSourceHost() *schema.Resource {
 }
 
 func dataSourceHostRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var host rest.Host
-	ip, ipOk := d.GetOk("ip")
+	ip, ipOk := d.GetOk("ip_address")
 	hostname, hostnameOk := d.GetOk("hostname")
 
 	if ipOk {
-		hosts, err := client.ListHosts("ip=" + ip.(string))
+		var hosts []rest.Host
+		err := client.call(ctx, "GET hosts?ip="+ip.(string), func(c *rest.Client) (err error) {
+			hosts, err = c.ListHosts("ip=" + ip.(string))
+			return err
+		})
 		if err != nil || len(hosts) != 1 {
 			return diag.Errorf("Host not found")
 		}
 		host = hosts[0]
 	} else if hostnameOk {
-		hosts, err := client.ListHosts("hostname=" + hostname.(string))
+		var hosts []rest.Host
+		err := client.call(ctx, "GET hosts?hostname="+hostname.(string), func(c *rest.Client) (err error) {
+			hosts, err = c.ListHosts("hostname=" + hostname.(string))
+			return err
+		})
 		if err != nil || len(hosts) != 1 {
 			return diag.Errorf("Host not found")
 		}
@@ -58,6 +66,7 @@ func dataSourceHostRead(ctx context.Context, d *schema.ResourceData, m interface
 	} else {
 		return diag.Errorf("ip_address or hostname must be provided")
 	}
+	d.SetId(host.Hostid)
 	d.Set("ip_address", host.IP)
 	d.Set("hostname", host.Hostname)
 	d.Set("hostid", host.Hostid)
@@ -0,0 +1,36 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceHost(t *testing.T) {
+	fake := newFakeHive(t)
+	host := fake.addHost("10.0.0.11")
+	fake.addHost("10.0.0.12")
+
+	for _, config := range []map[string]interface{}{
+		{"ip_address": "10.0.0.11"},
+		{"hostname": host.Hostname},
+	} {
+		state, err := testReadDataSource(t, fake, "hiveio_host", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resource.ComposeTestCheckFunc(
+			resource.TestCheckResourceAttr("data.hiveio_host.test", "hostid", host.Hostid),
+			resource.TestCheckResourceAttr("data.hiveio_host.test", "ip_address", "10.0.0.11"),
+			resource.TestCheckResourceAttr("data.hiveio_host.test", "cluster_id", fake.cluster.ID),
+			resource.TestCheckResourceAttr("data.hiveio_host.test", "software_version", "8.4.0"),
+		)(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := testReadDataSource(t, fake, "hiveio_host", map[string]interface{}{"ip_address": "10.0.0.99"}); err == nil {
+		t.Fatal("expected an error for an unknown host")
+	}
+}
@@ -0,0 +1,127 @@
+package hiveio
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func dataSourceNetworks() *schema.Resource {
+	return &schema.Resource{
+		Description: "The networks data source lists the production and storage networks configured on the hosts of the cluster.",
+		ReadContext: dataSourceNetworksRead,
+		Schema: map[string]*schema.Schema{
+			"host_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"networks": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"host_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"hostname": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"role": {
+							Description: "`production` or `storage`.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"interface": {
+							Description: "The physical interface of the network.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"vlan": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"dhcp": {
+							Description: "Whether the host address is assigned by dhcp, only set for the production network.",
+							Type:        schema.TypeBool,
+							Computed:    true,
+						},
+						"ip_address": {
+							Description: "The static host address, only set for the storage network.",
+							Type:        schema.TypeString,
+							Computed:    true,
+						},
+						"netmask": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"dns": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"search": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceNetworksRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	hostID := d.Get("host_id").(string)
+	var hosts []rest.Host
+	endpoint := "GET hosts"
+	if hostID != "" {
+		endpoint = "GET host/" + hostID
+	}
+	err := client.call(ctx, endpoint, func(c *rest.Client) (err error) {
+		if hostID == "" {
+			hosts, err = c.ListHosts("")
+			return err
+		}
+		host, err := c.GetHost(hostID)
+		hosts = []rest.Host{host}
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Hostname < hosts[j].Hostname })
+
+	var result []interface{}
+	for _, host := range hosts {
+		production := host.Networking.Production
+		storage := host.Networking.Storage
+		result = append(result, map[string]interface{}{
+			"host_id":   host.Hostid,
+			"hostname":  host.Hostname,
+			"role":      "production",
+			"interface": production.Interface,
+			"vlan":      production.Vlan,
+			"dhcp":      production.Dhcp,
+			"dns":       production.DNS,
+			"search":    production.Search,
+		}, map[string]interface{}{
+			"host_id":    host.Hostid,
+			"hostname":   host.Hostname,
+			"role":       "storage",
+			"interface":  storage.Interface,
+			"vlan":       storage.Vlan,
+			"ip_address": storage.IP,
+			"netmask":    storage.Mask,
+		})
+	}
+
+	d.SetId(strconv.Itoa(schema.HashString("networks" + hostID)))
+	d.Set("networks", result)
+	return diag.Diagnostics{}
+}
@@ -0,0 +1,48 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceNetworks(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	host := fake.addHost("10.0.0.12")
+	fake.update(func() {
+		host.Networking.Production.Vlan = 10
+		host.Networking.Production.DNS = "10.0.0.2"
+		host.Networking.Storage.IP = "192.168.10.12"
+		host.Networking.Storage.Mask = "255.255.255.0"
+		host.Networking.Storage.Vlan = 20
+	})
+
+	state, err := testReadDataSource(t, fake, "hiveio_networks", map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.#", "4")(state); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = testReadDataSource(t, fake, "hiveio_networks", map[string]interface{}{"host_id": host.Hostid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.ComposeTestCheckFunc(
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.#", "2"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.0.role", "production"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.0.interface", "eth0"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.0.vlan", "10"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.0.dhcp", "true"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.0.dns", "10.0.0.2"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.1.role", "storage"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.1.interface", "eth1"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.1.ip_address", "192.168.10.12"),
+		resource.TestCheckResourceAttr("data.hiveio_networks.test", "networks.1.vlan", "20"),
+	)(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestDataSourceProfile(t *testing.T) {
+	fake := newFakeHive(t)
+	profile := fake.addProfile("default")
+	fake.update(func() {
+		profile.BrokerOptions = &rest.ProfileBrokerOptions{RedirectUSB: true, SmartResize: true}
+		profile.Vlan = 20
+		profile.UserVolumes = &rest.ProfileUserVolumes{Repository: "user-volumes", Size: 10}
+		profile.AdConfig = &rest.ProfileADConfig{Domain: "TEST", Username: "svc_join", UserGroup: "hive-users", Ou: "OU=Guests"}
+	})
+
+	state, err := testReadDataSource(t, fake, "hiveio_profile", map[string]interface{}{"name": "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.ComposeTestCheckFunc(
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "id", profile.ID),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "timezone", "disabled"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "broker_options.0.rdp.0.redirect_usb", "true"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "broker_options.0.html5.0.enabled", "false"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "vlan", "20"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "user_volumes.0.size", "10"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "ad_config.0.domain", "TEST"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "ad_config.0.username", "svc_join"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "ad_config.0.user_group", "hive-users"),
+		resource.TestCheckResourceAttr("data.hiveio_profile.test", "ad_config.0.ou", "OU=Guests"),
+	)(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
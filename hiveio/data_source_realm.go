@@ -0,0 +1,34 @@
+package hiveio
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func dataSourceRealm() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceRealm(), "verify_on_apply")
+	s["name"].Required = true
+	s["name"].Computed = false
+	return &schema.Resource{
+		Description: "The realm data source can be used to retrieve settings from an existing realm.",
+		ReadContext: dataSourceRealmRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceRealmRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var realm rest.Realm
+	err := client.call(ctx, "GET realm/"+d.Get("name").(string), func(c *rest.Client) (err error) {
+		realm, err = c.GetRealm(d.Get("name").(string))
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(realm.Name)
+	return resourceRealmRead(ctx, d, m)
+}
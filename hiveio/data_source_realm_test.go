@@ -0,0 +1,30 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestDataSourceRealm(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addRealm(rest.Realm{Name: "EXAMPLE", FQDN: "example.com"})
+
+	state, err := testReadDataSource(t, fake, "hiveio_realm", map[string]interface{}{"name": "EXAMPLE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.ComposeTestCheckFunc(
+		resource.TestCheckResourceAttr("data.hiveio_realm.test", "id", "EXAMPLE"),
+		resource.TestCheckResourceAttr("data.hiveio_realm.test", "fqdn", "example.com"),
+		resource.TestCheckNoResourceAttr("data.hiveio_realm.test", "password"),
+	)(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testReadDataSource(t, fake, "hiveio_realm", map[string]interface{}{"name": "UNKNOWN"}); err == nil {
+		t.Fatal("expected an error for an unknown realm")
+	}
+}
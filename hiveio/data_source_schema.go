@@ -0,0 +1,36 @@
+package hiveio
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// dataSourceSchemaFromResource returns the attributes of a resource as
+// computed attributes for the matching data source. Sensitive attributes and
+// the arguments listed in exclude are left out.
+func dataSourceSchemaFromResource(r *schema.Resource, exclude ...string) map[string]*schema.Schema {
+	skip := map[string]bool{}
+	for _, k := range exclude {
+		skip[k] = true
+	}
+	computed := map[string]*schema.Schema{}
+	for k, s := range r.Schema {
+		if skip[k] || s.Sensitive {
+			continue
+		}
+		computed[k] = computedSchema(s)
+	}
+	return computed
+}
+
+func computedSchema(s *schema.Schema) *schema.Schema {
+	c := &schema.Schema{
+		Type:        s.Type,
+		Description: s.Description,
+		Computed:    true,
+		Elem:        s.Elem,
+	}
+	if elem, ok := s.Elem.(*schema.Resource); ok {
+		c.Elem = &schema.Resource{Schema: dataSourceSchemaFromResource(elem)}
+	}
+	return c
+}
@@ -56,22 +56,28 @@ func dataSourceStoragePool() *schema.Resource {
 }
 
 func dataSourceStoragePoolRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var storage *rest.StoragePool
 	var err error
 
 	id, idOk := d.GetOk("id")
 	name, nameOk := d.GetOk("name")
 	if idOk {
-		storage, err = client.GetStoragePool(id.(string))
+		err = client.call(ctx, "GET storage/pool/"+id.(string), func(c *rest.Client) (err error) {
+			storage, err = c.GetStoragePool(id.(string))
+			return err
+		})
 	} else if nameOk {
-		storage, err = client.GetStoragePoolByName(name.(string))
+		err = client.call(ctx, "GET storage/pools?name="+name.(string), func(c *rest.Client) (err error) {
+			storage, err = c.GetStoragePoolByName(name.(string))
+			return err
+		})
 	} else {
 		return diag.Errorf("id or name must be provided")
 	}
 
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(storage.ID)
 	d.Set("name", storage.Name)
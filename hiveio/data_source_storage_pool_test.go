@@ -0,0 +1,30 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceStoragePool(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+
+	for _, config := range []map[string]interface{}{
+		{"id": storage.ID},
+		{"name": "vms"},
+	} {
+		state, err := testReadDataSource(t, fake, "hiveio_storage_pool", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = resource.ComposeTestCheckFunc(
+			resource.TestCheckResourceAttr("data.hiveio_storage_pool.test", "id", storage.ID),
+			resource.TestCheckResourceAttr("data.hiveio_storage_pool.test", "type", "nfs"),
+			resource.TestCheckResourceAttr("data.hiveio_storage_pool.test", "roles.#", "2"),
+		)(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package hiveio
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func dataSourceTemplate() *schema.Resource {
+	s := dataSourceSchemaFromResource(resourceTemplate())
+	s["name"].Required = true
+	s["name"].Computed = false
+	return &schema.Resource{
+		Description: "The template data source can be used to retrieve settings from an existing template.",
+		ReadContext: dataSourceTemplateRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceTemplateRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var template rest.Template
+	err := client.call(ctx, "GET template/"+d.Get("name").(string), func(c *rest.Client) (err error) {
+		template, err = c.GetTemplate(d.Get("name").(string))
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(template.Name)
+	return resourceTemplateRead(ctx, d, m)
+}
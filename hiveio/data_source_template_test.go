@@ -0,0 +1,31 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceTemplate(t *testing.T) {
+	fake, _ := testGuestPoolFake(t)
+
+	state, err := testReadDataSource(t, fake, "hiveio_template", map[string]interface{}{"name": "win10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = resource.ComposeTestCheckFunc(
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "id", "win10"),
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "os", "win10"),
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "cpu", "2"),
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "display_driver", "qxl"),
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "disk.0.filename", "win10.qcow2"),
+		resource.TestCheckResourceAttr("data.hiveio_template.test", "interface.0.network", "prod"),
+	)(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testReadDataSource(t, fake, "hiveio_template", map[string]interface{}{"name": "unknown"}); err == nil {
+		t.Fatal("expected an error for an unknown template")
+	}
+}
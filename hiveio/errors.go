@@ -0,0 +1,162 @@
+package hiveio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// Error kinds returned by the hive fabric rest api. An *apiError unwraps to
+// one of these so callers can use errors.Is to check the kind of failure.
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errNotFound     = errors.New("not found")
+	errConflict     = errors.New("conflict")
+	errLocked       = errors.New("locked")
+	errServerError  = errors.New("server error")
+)
+
+// apiError is a non 2xx response from the rest api with the decoded body.
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if e.Code != "" && msg != "" {
+		msg = e.Code + ": " + msg
+	} else if e.Code != "" {
+		msg = e.Code
+	}
+	if msg == "" {
+		return fmt.Sprintf("hive api error %d", e.StatusCode)
+	}
+	return fmt.Sprintf("hive api error %d: %s", e.StatusCode, msg)
+}
+
+func (e *apiError) Unwrap() error {
+	switch {
+	case e.StatusCode == 401:
+		return errUnauthorized
+	case e.StatusCode == 404:
+		return errNotFound
+	case e.StatusCode == 409:
+		return errConflict
+	case e.StatusCode == 423:
+		return errLocked
+	case e.StatusCode >= 500:
+		return errServerError
+	}
+	return nil
+}
+
+// rest.Client formats api errors as {"error": <status>, "message": <body>}
+const (
+	apiErrorPrefix    = `{"error": `
+	apiErrorSeparator = `, "message": `
+)
+
+// parseAPIError converts an error returned by rest.Client into an *apiError.
+// Errors wrapped with %w are unwrapped first. Only messages that match the
+// client's error format from the start are converted, a status code
+// elsewhere in a message is ignored.
+func parseAPIError(err error) (*apiError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if apiErr, ok := parseAPIMessage(err.Error()); ok {
+			return apiErr, true
+		}
+	}
+	return nil, false
+}
+
+func parseAPIMessage(s string) (*apiError, bool) {
+	if !strings.HasPrefix(s, apiErrorPrefix) || !strings.HasSuffix(s, "}") {
+		return nil, false
+	}
+	s = s[len(apiErrorPrefix) : len(s)-1]
+	i := strings.Index(s, apiErrorSeparator)
+	if i < 0 {
+		return nil, false
+	}
+	status, convErr := strconv.Atoi(s[:i])
+	if convErr != nil {
+		return nil, false
+	}
+	apiErr := &apiError{StatusCode: status}
+	body := strings.TrimSpace(s[i+len(apiErrorSeparator):])
+
+	// {"code":"LockedError","message":"Storage pool vms is in use and can not be deleted"}
+	var msg struct {
+		Code    string          `json:"code"`
+		Message json.RawMessage `json:"message"`
+		Error   string          `json:"error"`
+	}
+	if json.Unmarshal([]byte(body), &msg) != nil {
+		apiErr.Message = body
+		return apiErr, true
+	}
+	apiErr.Code = msg.Code
+	var text string
+	if json.Unmarshal(msg.Message, &text) == nil {
+		apiErr.Message = text
+	} else if len(msg.Message) > 0 {
+		apiErr.Message = string(msg.Message)
+	} else if msg.Error != "" {
+		apiErr.Message = msg.Error
+	} else if msg.Code == "" {
+		apiErr.Message = body
+	}
+	return apiErr, true
+}
+
+// classifyError returns an *apiError for rest api errors and err unchanged
+// for anything else.
+func classifyError(err error) error {
+	if apiErr, ok := parseAPIError(err); ok {
+		return apiErr
+	}
+	return err
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(classifyError(err), errNotFound)
+}
+
+func isLocked(err error) bool {
+	return errors.Is(classifyError(err), errLocked)
+}
+
+func isUnauthorized(err error) bool {
+	return errors.Is(classifyError(err), errUnauthorized)
+}
+
+// diagFromErr is diag.FromErr with rest api errors decoded. A failed task
+// has its message as the detail. Unlike diag.FromErr it returns no
+// diagnostics for a nil error.
+func diagFromErr(err error) diag.Diagnostics {
+	if err == nil {
+		return nil
+	}
+	var taskErr *taskError
+	if errors.As(err, &taskErr) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("Task %s failed", taskErr.task.Name),
+			Detail:   taskErr.task.Message,
+		}}
+	}
+	return diag.FromErr(classifyError(err))
+}
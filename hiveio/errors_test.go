@@ -0,0 +1,145 @@
+package hiveio
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseAPIError(t *testing.T) {
+	notFound := errors.New(`{"error": 404, "message": {"code":"NotFoundError","message":"guest DESK1 not found"}}`)
+	tests := []struct {
+		name    string
+		err     error
+		ok      bool
+		status  int
+		code    string
+		message string
+		kind    error
+	}{
+		{
+			name:    "not found",
+			err:     notFound,
+			ok:      true,
+			status:  404,
+			code:    "NotFoundError",
+			message: "guest DESK1 not found",
+			kind:    errNotFound,
+		},
+		{
+			name:    "wrapped not found",
+			err:     fmt.Errorf("reading guest DESK1: %w", notFound),
+			ok:      true,
+			status:  404,
+			code:    "NotFoundError",
+			message: "guest DESK1 not found",
+			kind:    errNotFound,
+		},
+		{
+			name: "404 inside an unrelated message",
+			err:  fmt.Errorf("copy of %s failed: %v", "disk.qcow2", notFound),
+		},
+		{
+			name: "404 inside a task message",
+			err:  errors.New(`task failed: url returned {"error": 404, "message": "missing"}`),
+		},
+		{
+			name:    "unauthorized",
+			err:     errors.New(`{"error": 401, "message": {"error":"Unauthorized"}}`),
+			ok:      true,
+			status:  401,
+			message: "Unauthorized",
+			kind:    errUnauthorized,
+		},
+		{
+			name:    "locked",
+			err:     errors.New(`{"error": 423, "message": {"code":"LockedError","message":"Storage pool vms is in use and can not be deleted"}}`),
+			ok:      true,
+			status:  423,
+			code:    "LockedError",
+			message: "Storage pool vms is in use and can not be deleted",
+			kind:    errLocked,
+		},
+		{
+			name:   "conflict",
+			err:    errors.New(`{"error": 409, "message": {"code":"ConflictError"}}`),
+			ok:     true,
+			status: 409,
+			code:   "ConflictError",
+			kind:   errConflict,
+		},
+		{
+			name:    "body that is not json",
+			err:     errors.New(`{"error": 502, "message": <html><body>Bad Gateway</body></html>}`),
+			ok:      true,
+			status:  502,
+			message: "<html><body>Bad Gateway</body></html>",
+			kind:    errServerError,
+		},
+		{
+			name:    "bad request",
+			err:     errors.New(`{"error": 400, "message": {"message":"Not enough hosts to enable shared storage"}}`),
+			ok:      true,
+			status:  400,
+			message: "Not enough hosts to enable shared storage",
+		},
+		{
+			name: "status that is not a number",
+			err:  errors.New(`{"error": "x", "message": "y"}`),
+		},
+		{
+			name: "other error",
+			err:  errors.New("connection refused"),
+		},
+	}
+	for _, tc := range tests {
+		apiErr, ok := parseAPIError(tc.err)
+		if ok != tc.ok {
+			t.Errorf("%s: expected ok %v, got %v", tc.name, tc.ok, ok)
+			continue
+		}
+		if !ok {
+			if classified := classifyError(tc.err); classified != tc.err {
+				t.Errorf("%s: expected the error unchanged, got %v", tc.name, classified)
+			}
+			if isNotFound(tc.err) {
+				t.Errorf("%s: expected the error not to be a not found error", tc.name)
+			}
+			continue
+		}
+		if apiErr.StatusCode != tc.status || apiErr.Code != tc.code || apiErr.Message != tc.message {
+			t.Errorf("%s: got status %d, code %q, message %q", tc.name, apiErr.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		if kind := errors.Unwrap(classifyError(tc.err)); kind != tc.kind {
+			t.Errorf("%s: expected kind %v, got %v", tc.name, tc.kind, kind)
+		}
+	}
+}
+
+func TestClassifyErrorMessage(t *testing.T) {
+	err := classifyError(errors.New(`{"error": 423, "message": {"code":"LockedError","message":"Storage pool vms is in use"}}`))
+	if err.Error() != "hive api error 423: LockedError: Storage pool vms is in use" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	err = classifyError(errors.New(`{"error": 401, "message": }`))
+	if err.Error() != "hive api error 401" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestIsNotEnoughHosts(t *testing.T) {
+	for _, err := range []error{
+		errors.New(`{"error": 400, "message": {"message":"Not enough hosts to enable shared storage"}}`),
+		errors.New(`{"error": 500, "message": "Error: Not enough hosts available"}`),
+		errors.New("Not enough hosts"),
+	} {
+		if !isNotEnoughHosts(err) {
+			t.Errorf("expected %v to be a host shortage", err)
+		}
+	}
+	for _, err := range []error{nil, errors.New(`{"error": 400, "message": "invalid set size"}`)} {
+		if isNotEnoughHosts(err) {
+			t.Errorf("expected %v not to be a host shortage", err)
+		}
+	}
+}
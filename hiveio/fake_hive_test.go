@@ -0,0 +1,1492 @@
+package hiveio
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+const (
+	fakeUsername = "admin"
+	fakePassword = "admin"
+	gigabyte     = 1024 * 1024 * 1024
+)
+
+// fakeHive is an in-memory hive fabric rest api for unit tests. Records are
+// stored with the rest package types, tasks finish shortly after they are
+// started and changes are pushed to changefeed websockets like the real api.
+type fakeHive struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu           sync.Mutex
+	token        string
+	sessions     int
+	cluster      rest.Cluster
+	hosts        map[string]*rest.Host
+	pools        map[string]*rest.Pool
+	guests       map[string]*rest.Guest
+	templates    map[string]*rest.Template
+	storagePools map[string]*rest.StoragePool
+	disks        map[string]map[string]*rest.DiskInfo
+	contents     map[string][]byte
+	uploads      map[string]*fakeUpload
+	tasks        map[string]*rest.Task
+	realms       map[string]*rest.Realm
+	users        map[string]*rest.User
+	profiles     map[string]*rest.Profile
+	// profilePasswords are the ad_config passwords of profiles, the api
+	// does not return them.
+	profilePasswords map[string]string
+	failures         []*fakeFailure
+	requests         []string
+	// ignoreShutdown makes guests ignore graceful shutdown requests.
+	ignoreShutdown bool
+	// ipDelay delays the ip addresses reported by new guests.
+	ipDelay time.Duration
+	// refreshing counts the guests being rebuilt and maxRefreshing the
+	// most that were rebuilt at the same time.
+	refreshing    int
+	maxRefreshing int
+	// failUploadChunks fails the next upload chunks after the first one
+	// and uploadOffsets records the offsets of all chunks.
+	failUploadChunks int
+	uploadOffsets    []int64
+	// taskDuration is how long tasks run, 20ms when it is not set.
+	taskDuration time.Duration
+	// buildDelay is how long new pool guests are provisioning and
+	// buildErrors fails the build of the named guests with a message.
+	buildDelay  time.Duration
+	buildErrors map[string]string
+	// adPassword is the password of realm service accounts, realms saved
+	// with another password are not verified.
+	adPassword string
+}
+
+// fakeUpload is a tus upload into a storage pool.
+type fakeUpload struct {
+	storageID string
+	filename  string
+	length    int64
+	data      []byte
+}
+
+// fakeRaw is a response body that is not encoded as json.
+type fakeRaw []byte
+
+// fakeFailure makes the next request matching method and path fail.
+type fakeFailure struct {
+	method string
+	path   string
+	status int
+	body   string
+}
+
+func newFakeHive(t *testing.T) *fakeHive {
+	f := &fakeHive{
+		t:                t,
+		token:            uuid.New().String(),
+		hosts:            map[string]*rest.Host{},
+		pools:            map[string]*rest.Pool{},
+		guests:           map[string]*rest.Guest{},
+		templates:        map[string]*rest.Template{},
+		storagePools:     map[string]*rest.StoragePool{},
+		disks:            map[string]map[string]*rest.DiskInfo{},
+		contents:         map[string][]byte{},
+		uploads:          map[string]*fakeUpload{},
+		tasks:            map[string]*rest.Task{},
+		realms:           map[string]*rest.Realm{},
+		users:            map[string]*rest.User{},
+		profiles:         map[string]*rest.Profile{},
+		profilePasswords: map[string]string{},
+	}
+	f.cluster = rest.Cluster{
+		ID:      uuid.New().String(),
+		Name:    "test-cluster",
+		Broker:  &rest.Broker{Enabled: true, Title: "Hive", Logo: "logo.png"},
+		Gateway: &rest.Gateway{URI: "wss://gateway.example.com"},
+	}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// host and port of the fake server for the provider configuration.
+func (f *fakeHive) address() (string, int) {
+	u, err := url.Parse(f.server.URL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return u.Hostname(), port
+}
+
+func (f *fakeHive) providerConfig() map[string]interface{} {
+	host, port := f.address()
+	return map[string]interface{}{
+		"host":     host,
+		"port":     port,
+		"username": fakeUsername,
+		"password": fakePassword,
+		"realm":    "local",
+		"insecure": true,
+	}
+}
+
+// expireSession invalidates the current token like a session timeout.
+func (f *fakeHive) expireSession() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = uuid.New().String()
+}
+
+// loginCount returns the number of successful logins.
+func (f *fakeHive) loginCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions
+}
+
+// failNext makes the next request for method and path return status.
+func (f *fakeHive) failNext(method, path string, status int, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, &fakeFailure{method: method, path: path, status: status, body: body})
+}
+
+// requestCount returns the number of requests made for method and path.
+func (f *fakeHive) requestCount(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, r := range f.requests {
+		if r == method+" "+path {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeHive) addHost(ip string) *rest.Host {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addHostLocked(ip)
+}
+
+func (f *fakeHive) addHostLocked(ip string) *rest.Host {
+	host := &rest.Host{
+		Hostid:   uuid.New().String(),
+		Hostname: fmt.Sprintf("hive%d", len(f.hosts)+1),
+		IP:       ip,
+		State:    "available",
+	}
+	host.Appliance.ClusterID = f.cluster.ID
+	host.Appliance.Hostname = host.Hostname
+	host.Appliance.Firmware.Software = "8.4.0"
+	host.Networking.Production.Interface = "eth0"
+	host.Networking.Production.Dhcp = true
+	host.Networking.Storage.Interface = "eth1"
+	f.hosts[host.Hostid] = host
+	return host
+}
+
+func (f *fakeHive) addStoragePool(name string) *rest.StoragePool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pool := &rest.StoragePool{
+		ID:     uuid.New().String(),
+		Name:   name,
+		Type:   "nfs",
+		Server: "nas",
+		Path:   "/" + name,
+		Roles:  []string{"guest", "template"},
+	}
+	f.storagePools[pool.ID] = pool
+	f.disks[pool.ID] = map[string]*rest.DiskInfo{}
+	return pool
+}
+
+func (f *fakeHive) addDisk(storageID, filename, format string, size uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disks[storageID][filename] = &rest.DiskInfo{Filename: filename, Format: format, VirtualSize: size * gigabyte}
+}
+
+func (f *fakeHive) addTemplate(template rest.Template) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.templates[template.Name] = &template
+}
+
+func (f *fakeHive) addProfile(name string) *rest.Profile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	profile := &rest.Profile{ID: uuid.New().String(), Name: name, Timezone: "disabled"}
+	f.profiles[profile.ID] = profile
+	return profile
+}
+
+func (f *fakeHive) addRealm(realm rest.Realm) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.realms[realm.Name] = &realm
+}
+
+// update runs fn with the lock held so tests can change records directly.
+func (f *fakeHive) update(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn()
+}
+
+func (f *fakeHive) pool(id string) *rest.Pool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pools[id]
+}
+
+func (f *fakeHive) guest(name string) *rest.Guest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.guests[name]
+}
+
+func (f *fakeHive) host(id string) *rest.Host {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hosts[id]
+}
+
+func (f *fakeHive) disk(storageID, filename string) *rest.DiskInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.disks[storageID][filename]
+}
+
+// startTask records a running task and completes it shortly after with the
+// result of done. An error from done fails the task with its message.
+func (f *fakeHive) startTask(name, hostid string, done func() error) *rest.Task {
+	task := &rest.Task{
+		ID:          uuid.New().String(),
+		Name:        name,
+		State:       "running",
+		StartTime:   time.Now(),
+		Cancellable: true,
+	}
+	task.Ref.Cluster = f.cluster.ID
+	task.Ref.Host = hostid
+	f.tasks[task.ID] = task
+	duration := 20 * time.Millisecond
+	if f.taskDuration > 0 {
+		duration = f.taskDuration
+	}
+	time.AfterFunc(duration, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		task.Progress = 100
+		task.FinishedTime = time.Now()
+		if err := done(); err != nil {
+			task.State = "failed"
+			task.Message = err.Error()
+			return
+		}
+		task.State = "completed"
+	})
+	return task
+}
+
+type fakeError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *fakeError) Error() string {
+	return e.message
+}
+
+func notFound(format string, args ...interface{}) *fakeError {
+	return &fakeError{http.StatusNotFound, "NotFoundError", fmt.Sprintf(format, args...)}
+}
+
+func badRequest(format string, args ...interface{}) *fakeError {
+	return &fakeError{http.StatusBadRequest, "ValidationError", fmt.Sprintf(format, args...)}
+}
+
+func locked(format string, args ...interface{}) *fakeError {
+	return &fakeError{http.StatusLocked, "LockedError", fmt.Sprintf(format, args...)}
+}
+
+func (f *fakeHive) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/socket.io/" {
+		f.serveChangeFeed(w, r)
+		return
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+path)
+
+	for i, failure := range f.failures {
+		if failure.method == r.Method && failure.path == path {
+			f.failures = append(f.failures[:i], f.failures[i+1:]...)
+			w.WriteHeader(failure.status)
+			w.Write([]byte(failure.body))
+			return
+		}
+	}
+
+	if path == "auth" && r.Method == "POST" {
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		if login["username"] != fakeUsername || login["password"] != fakePassword {
+			writeError(w, &fakeError{http.StatusUnauthorized, "AuthenticationError", "invalid username or password"})
+			return
+		}
+		f.sessions++
+		writeJSON(w, map[string]string{"token": f.token})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		writeError(w, &fakeError{http.StatusUnauthorized, "AuthenticationError", "jwt expired"})
+		return
+	}
+	if strings.HasPrefix(path, "upload/") {
+		f.serveUpload(w, r, strings.TrimPrefix(path, "upload/"))
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body = readAll(r)
+	}
+	result, err := f.route(r.Method, strings.Split(path, "/"), r.URL.Query(), body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// requests that start a task respond with its id
+	if task, ok := result.(*rest.Task); ok {
+		result = map[string]string{"taskId": task.ID}
+	}
+	if raw, ok := result.(fakeRaw); ok {
+		w.Write(raw)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// serveUpload implements the parts of the tus protocol used to upload files
+// into storage pools.
+func (f *fakeHive) serveUpload(w http.ResponseWriter, r *http.Request, id string) {
+	w.Header().Set("Tus-Resumable", "1.0.0")
+	if r.Method == "POST" {
+		length, _ := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		metadata := map[string]string{}
+		for _, pair := range strings.Split(r.Header.Get("Upload-Metadata"), ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+			if len(kv) == 2 {
+				value, _ := base64.StdEncoding.DecodeString(kv[1])
+				metadata[kv[0]] = string(value)
+			}
+		}
+		if _, ok := f.disks[metadata["storageId"]]; !ok {
+			writeError(w, notFound("storage pool %s not found", metadata["storageId"]))
+			return
+		}
+		id := uuid.New().String()
+		f.uploads[id] = &fakeUpload{storageID: metadata["storageId"], filename: metadata["filename"], length: length}
+		w.Header().Set("Location", f.server.URL+"/upload/"+id)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	upload, ok := f.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "HEAD":
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(upload.data)))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.length, 10))
+		w.WriteHeader(http.StatusOK)
+	case "PATCH":
+		offset, _ := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		f.uploadOffsets = append(f.uploadOffsets, offset)
+		if offset != int64(len(upload.data)) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if f.failUploadChunks > 0 && offset > 0 {
+			f.failUploadChunks--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		upload.data = append(upload.data, readAll(r)...)
+		if int64(len(upload.data)) == upload.length {
+			f.disks[upload.storageID][upload.filename] = &rest.DiskInfo{Filename: upload.filename, Format: "qcow2", VirtualSize: gigabyte}
+			f.contents[upload.storageID+"/"+upload.filename] = upload.data
+			delete(f.uploads, id)
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(upload.data)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func readAll(r *http.Request) []byte {
+	var buf strings.Builder
+	b := make([]byte, 4096)
+	for {
+		n, err := r.Body.Read(b)
+		buf.Write(b[:n])
+		if err != nil {
+			break
+		}
+	}
+	return []byte(buf.String())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	code := "InternalError"
+	if fe, ok := err.(*fakeError); ok {
+		status = fe.status
+		code = fe.code
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": err.Error()})
+}
+
+func (f *fakeHive) route(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	switch path[0] {
+	case "task":
+		return f.routeTask(method, path, body)
+	case "host", "hosts":
+		return f.routeHost(method, path, query, body)
+	case "cluster", "clusters":
+		return f.routeCluster(method, path, query, body)
+	case "pool", "pools":
+		return f.routePool(method, path, query, body)
+	case "guest", "guests":
+		return f.routeGuest(method, path, query, body)
+	case "template", "templates":
+		return f.routeTemplate(method, path, query, body)
+	case "storage":
+		return f.routeStorage(method, path[1:], query, body)
+	case "realm", "realms":
+		return f.routeRealm(method, path, query, body)
+	case "user", "users":
+		return f.routeUser(method, path, query, body)
+	case "profile", "profiles":
+		return f.routeProfile(method, path, query, body)
+	case "broker":
+		return f.routeBroker(method, path, body)
+	}
+	return nil, notFound("unknown path %s", strings.Join(path, "/"))
+}
+
+func (f *fakeHive) routeTask(method string, path []string, body []byte) (interface{}, error) {
+	if len(path) == 2 && method == "GET" {
+		if task, ok := f.tasks[path[1]]; ok {
+			return *task, nil
+		}
+		return nil, notFound("task %s not found", path[1])
+	}
+	return nil, notFound("unknown task request")
+}
+
+func (f *fakeHive) routeHost(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "hosts" {
+		return filterRecords(f.hostList(), query), nil
+	}
+	if len(path) == 2 && (path[1] == "clusterid" || path[1] == "hostid") {
+		return map[string]string{"id": f.cluster.ID}, nil
+	}
+	if len(path) == 2 && path[1] == "version" {
+		return rest.Version{Major: 8, Minor: 5, Version: "8.5.0"}, nil
+	}
+	host, ok := f.hosts[path[1]]
+	if !ok {
+		return nil, notFound("host %s not found", path[1])
+	}
+	switch {
+	case len(path) == 2 && method == "GET":
+		return host, nil
+	case len(path) == 2 && method == "PUT":
+		var update rest.Host
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		host.Appliance = update.Appliance
+		return host.Hostid, nil
+	case len(path) == 3 && path[2] == "state" && method == "GET":
+		return host.State, nil
+	case len(path) == 3 && path[2] == "state" && method == "POST":
+		state := query.Get("state")
+		return f.startTask("set host state", host.Hostid, func() error {
+			host.State = state
+			if state == "maintenance" {
+				time.AfterFunc(50*time.Millisecond, func() {
+					f.update(func() { f.migrateGuests(host) })
+				})
+			}
+			return nil
+		}), nil
+	case len(path) == 4 && path[2] == "cluster" && path[3] == "unjoin":
+		if host.State != "maintenance" {
+			return nil, badRequest("host must be in maintenance mode")
+		}
+		delete(f.hosts, host.Hostid)
+		if shared := f.cluster.SharedStorage; shared != nil {
+			for i, member := range shared.Hosts {
+				if member.Hostid == host.Hostid {
+					shared.Hosts = append(shared.Hosts[:i], shared.Hosts[i+1:]...)
+					break
+				}
+			}
+		}
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown host request")
+}
+
+// migrateGuests moves the guests of a host in maintenance to the first
+// available host. Guests stay when there is no other host.
+func (f *fakeHive) migrateGuests(host *rest.Host) {
+	for _, record := range f.hostList() {
+		target := record.(*rest.Host)
+		if target == host || target.State != "available" {
+			continue
+		}
+		for _, guest := range f.guests {
+			if guest.Hostid == host.Hostid {
+				guest.Hostid = target.Hostid
+			}
+		}
+		return
+	}
+}
+
+func (f *fakeHive) hostList() []interface{} {
+	var ids []string
+	for id := range f.hosts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return f.hosts[ids[i]].Hostname < f.hosts[ids[j]].Hostname })
+	var hosts []interface{}
+	for _, id := range ids {
+		hosts = append(hosts, f.hosts[id])
+	}
+	return hosts
+}
+
+func (f *fakeHive) routeCluster(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "clusters" {
+		return []rest.Cluster{f.cluster}, nil
+	}
+	if len(path) == 2 && path[1] == "joinHost" && method == "POST" {
+		var data map[string]string
+		json.Unmarshal(body, &data)
+		if data["remotePassword"] == "" {
+			return nil, badRequest("remotePassword is required")
+		}
+		host := f.addHostLocked(data["remoteIpAddress"])
+		delete(f.hosts, host.Hostid)
+		return f.startTask("join host", host.Hostid, func() error {
+			f.hosts[host.Hostid] = host
+			return nil
+		}), nil
+	}
+	if path[1] != f.cluster.ID {
+		return nil, notFound("cluster %s not found", path[1])
+	}
+	switch {
+	case len(path) == 2 && method == "GET":
+		return f.cluster, nil
+	case len(path) == 3 && path[2] == "license" && method == "PUT":
+		var data map[string]string
+		json.Unmarshal(body, &data)
+		if data["key"] == "" {
+			return nil, badRequest("invalid license")
+		}
+		license := fmt.Sprintf(`{"license":{"type":"enterprise","expiration":%q,"maxGuests":100}}`,
+			time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339))
+		json.Unmarshal([]byte(license), &f.cluster)
+		return map[string]string{}, nil
+	case len(path) == 3 && path[2] == "broker" && method == "GET":
+		return f.cluster.Broker, nil
+	case len(path) == 3 && path[2] == "broker" && method == "PUT":
+		var broker rest.Broker
+		if err := json.Unmarshal(body, &broker); err != nil {
+			return nil, badRequest("invalid broker settings: %v", err)
+		}
+		f.cluster.Broker = &broker
+		return map[string]string{}, nil
+	case len(path) == 3 && path[2] == "enableBackup" && method == "POST":
+		var data map[string]string
+		json.Unmarshal(body, &data)
+		if data["startWindow"] == "" || data["endWindow"] == "" {
+			return nil, badRequest("startWindow and endWindow are required")
+		}
+		f.cluster.Backup = &rest.ClusterBackup{Enabled: true, StartWindow: data["startWindow"], EndWindow: data["endWindow"]}
+		return map[string]string{}, nil
+	case len(path) == 3 && path[2] == "disableBackup" && method == "POST":
+		if f.cluster.Backup == nil || !f.cluster.Backup.Enabled {
+			return nil, badRequest("backup is not enabled")
+		}
+		f.cluster.Backup.Enabled = false
+		return map[string]string{}, nil
+	case len(path) == 3 && path[2] == "enableSharedStorage" && method == "POST":
+		var data map[string]int
+		json.Unmarshal(body, &data)
+		if len(f.hosts) < data["minSetSize"] {
+			return nil, badRequest("Not enough hosts to enable shared storage")
+		}
+		return f.startTask("enable shared storage", "", func() error {
+			storage := &rest.StoragePool{ID: uuid.New().String(), Name: "sharedStorage", Type: "gluster", Roles: []string{"guest", "template"}}
+			f.storagePools[storage.ID] = storage
+			f.disks[storage.ID] = map[string]*rest.DiskInfo{}
+			var members []string
+			for _, host := range f.hostList() {
+				members = append(members, fmt.Sprintf(`{"hostid":%q,"state":"ready"}`, host.(*rest.Host).Hostid))
+			}
+			shared := fmt.Sprintf(`{"sharedStorage":{"enabled":true,"hosts":[%s],"id":%q,"minSetSize":%d,"storageUtilization":%d,"state":"ready"}}`,
+				strings.Join(members, ","), storage.ID, data["minSetSize"], data["storageUtilization"])
+			return json.Unmarshal([]byte(shared), &f.cluster)
+		}), nil
+	case len(path) == 3 && path[2] == "disableSharedStorage" && method == "POST":
+		if f.cluster.SharedStorage == nil {
+			return nil, badRequest("shared storage is not enabled")
+		}
+		return f.startTask("disable shared storage", "", func() error {
+			delete(f.storagePools, f.cluster.SharedStorage.ID)
+			f.cluster.SharedStorage = nil
+			return nil
+		}), nil
+	}
+	return nil, notFound("unknown cluster request")
+}
+
+func guestName(name string) string {
+	return strings.ReplaceAll(strings.ToUpper(name), " ", "_")
+}
+
+func (f *fakeHive) routePool(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "pools" {
+		switch method {
+		case "GET":
+			var pools []interface{}
+			for _, id := range sortedKeys(f.pools) {
+				pools = append(pools, f.pools[id])
+			}
+			return filterRecords(pools, query), nil
+		case "POST":
+			var pool rest.Pool
+			if err := json.Unmarshal(body, &pool); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			for _, existing := range f.pools {
+				if existing.Name == pool.Name {
+					return nil, &fakeError{http.StatusConflict, "ConflictError", "pool " + pool.Name + " already exists"}
+				}
+			}
+			if pool.Type == "vdi" {
+				if _, ok := f.templates[pool.GuestProfile.TemplateName]; !ok {
+					return nil, badRequest("template %s not found", pool.GuestProfile.TemplateName)
+				}
+			}
+			pool.ID = uuid.New().String()
+			pool.State = "tracking"
+			f.pools[pool.ID] = &pool
+			f.buildGuests(&pool)
+			return map[string]string{"id": pool.ID}, nil
+		}
+	}
+	pool, ok := f.pools[path[1]]
+	if !ok {
+		return nil, notFound("pool %s not found", path[1])
+	}
+	switch {
+	case len(path) == 2 && method == "GET":
+		return pool, nil
+	case len(path) == 2 && method == "PUT":
+		var update rest.Pool
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		update.ID = pool.ID
+		update.State = pool.State
+		f.pools[pool.ID] = &update
+		f.buildGuests(&update)
+		for _, guest := range f.guests {
+			if guest.PoolID == pool.ID && (guest.GuestState == "stopped" || hotPluggable(guest, &update)) {
+				f.applyGuestDevices(guest)
+			}
+		}
+		return map[string]string{}, nil
+	case len(path) == 2 && method == "DELETE":
+		delete(f.pools, pool.ID)
+		for name, guest := range f.guests {
+			if guest.PoolID == pool.ID {
+				delete(f.guests, name)
+			}
+		}
+		return map[string]string{}, nil
+	case len(path) == 3 && path[2] == "refresh" && method == "POST":
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown pool request")
+}
+
+// buildGuests creates the guests for a pool up to the minimum density.
+func (f *fakeHive) buildGuests(pool *rest.Pool) {
+	names := []string{guestName(pool.Name)}
+	if pool.Type != "standalone" {
+		names = nil
+		for i := 1; i <= pool.Density[0]; i++ {
+			names = append(names, fmt.Sprintf("%s%d", guestName(pool.Seed), i))
+		}
+	}
+	hostid := ""
+	if hosts := f.hostList(); len(hosts) > 0 {
+		hostid = hosts[0].(*rest.Host).Hostid
+	}
+	for _, name := range names {
+		if _, ok := f.guests[name]; ok {
+			continue
+		}
+		guest := &rest.Guest{
+			Name:         name,
+			PoolID:       pool.ID,
+			ProfileID:    pool.ProfileID,
+			Hostid:       hostid,
+			GuestState:   "ready",
+			TargetState:  []string{"ready"},
+			TemplateName: pool.GuestProfile.TemplateName,
+			Os:           pool.GuestProfile.OS,
+			Persistent:   pool.GuestProfile.Persistent,
+			Standalone:   pool.Type == "standalone",
+			AgentVersion: "3.2.0",
+		}
+		f.applyGuestDevices(guest)
+		if f.buildDelay > 0 {
+			guest.GuestState = "provisioning"
+			message, failed := f.buildErrors[name]
+			time.AfterFunc(f.buildDelay, func() {
+				f.update(func() {
+					if failed {
+						guest.GuestState = "failed"
+						guest.Error = &rest.GuestError{Code: "BuildError", Message: message}
+						return
+					}
+					guest.GuestState = "ready"
+				})
+			})
+		}
+		if f.ipDelay > 0 {
+			reported := append([]rest.GuestNetwork(nil), guest.Interfaces...)
+			for j := range guest.Interfaces {
+				guest.Interfaces[j].IPAddress = ""
+			}
+			time.AfterFunc(f.ipDelay, func() {
+				f.update(func() { guest.Interfaces = reported })
+			})
+		}
+		f.guests[name] = guest
+	}
+}
+
+// applyGuestDevices gives guest the disks and interfaces of its pool.
+// Interfaces that are kept keep their mac and ip address.
+func (f *fakeHive) applyGuestDevices(guest *rest.Guest) {
+	pool, ok := f.pools[guest.PoolID]
+	if !ok {
+		return
+	}
+	guest.Disks = nil
+	for _, disk := range pool.GuestProfile.Disks {
+		guest.Disks = append(guest.Disks, rest.GuestDisk{
+			Type:       disk.Type,
+			DiskDriver: disk.DiskDriver,
+			Filename:   disk.Filename,
+			StorageID:  disk.StorageID,
+		})
+	}
+	existing := guest.Interfaces
+	guest.Interfaces = nil
+	for j, iface := range pool.GuestProfile.Interfaces {
+		vlan, _ := strconv.Atoi(fmt.Sprint(iface.Vlan))
+		network := rest.GuestNetwork{
+			Emulation:   iface.Emulation,
+			NetworkType: iface.Network,
+			Vlan:        vlan,
+			MacAddress:  fmt.Sprintf("52:54:00:00:%02x:%02x", len(f.guests), j),
+			IPAddress:   fmt.Sprintf("10.0.%d.%d", j, len(f.guests)+10),
+		}
+		for k, old := range existing {
+			if old.NetworkType == network.NetworkType && old.Vlan == network.Vlan {
+				network.MacAddress = old.MacAddress
+				network.IPAddress = old.IPAddress
+				existing = append(existing[:k:k], existing[k+1:]...)
+				break
+			}
+		}
+		guest.Interfaces = append(guest.Interfaces, network)
+	}
+}
+
+// hotPluggable reports whether the devices of pool can be changed in a
+// running guest, only devices that keep their order can be hot-plugged.
+func hotPluggable(guest *rest.Guest, pool *rest.Pool) bool {
+	var oldDisks, newDisks, oldInterfaces, newInterfaces []string
+	for _, disk := range guest.Disks {
+		oldDisks = append(oldDisks, disk.StorageID+"/"+disk.Filename+"/"+disk.DiskDriver)
+	}
+	for _, disk := range pool.GuestProfile.Disks {
+		newDisks = append(newDisks, disk.StorageID+"/"+disk.Filename+"/"+disk.DiskDriver)
+	}
+	for _, iface := range guest.Interfaces {
+		oldInterfaces = append(oldInterfaces, fmt.Sprintf("%s/%d/%s", iface.NetworkType, iface.Vlan, iface.Emulation))
+	}
+	for _, iface := range pool.GuestProfile.Interfaces {
+		vlan, _ := strconv.Atoi(fmt.Sprint(iface.Vlan))
+		newInterfaces = append(newInterfaces, fmt.Sprintf("%s/%d/%s", iface.Network, vlan, iface.Emulation))
+	}
+	return sameOrder(oldDisks, newDisks) && sameOrder(oldInterfaces, newInterfaces)
+}
+
+// sameOrder reports whether the keys that are in both a and b are in the
+// same order.
+func sameOrder(a, b []string) bool {
+	common := func(keys, other []string) []string {
+		var result []string
+		for _, key := range keys {
+			for _, o := range other {
+				if key == o {
+					result = append(result, key)
+					break
+				}
+			}
+		}
+		return result
+	}
+	return strings.Join(common(a, b), ",") == strings.Join(common(b, a), ",")
+}
+
+// refreshGuest rebuilds guest from the current definition of its pool.
+func (f *fakeHive) refreshGuest(guest *rest.Guest) {
+	guest.GuestState = "provisioning"
+	f.refreshing++
+	if f.refreshing > f.maxRefreshing {
+		f.maxRefreshing = f.refreshing
+	}
+	time.AfterFunc(50*time.Millisecond, func() {
+		f.update(func() {
+			f.refreshing--
+			if pool, ok := f.pools[guest.PoolID]; ok {
+				guest.TemplateName = pool.GuestProfile.TemplateName
+			}
+			guest.GuestState = "ready"
+		})
+	})
+}
+
+func (f *fakeHive) routeGuest(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "guests" {
+		var guests []interface{}
+		for _, name := range sortedKeys(f.guests) {
+			guests = append(guests, f.guests[name])
+		}
+		return filterRecords(guests, query), nil
+	}
+	if len(path) == 2 && path[1] == "external" && method == "POST" {
+		var external rest.ExternalGuest
+		if err := json.Unmarshal(body, &external); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		if _, ok := f.guests[external.GuestName]; ok {
+			return nil, &fakeError{http.StatusConflict, "ConflictError", "guest " + external.GuestName + " already exists"}
+		}
+		f.guests[external.GuestName] = &rest.Guest{
+			Name:       external.GuestName,
+			Address:    external.Address,
+			Username:   external.Username,
+			Realm:      external.Realm,
+			Os:         external.OS,
+			External:   true,
+			GuestState: "ready",
+		}
+		return map[string]string{}, nil
+	}
+	name, _ := url.PathUnescape(path[1])
+	guest, ok := f.guests[name]
+	if !ok {
+		return nil, notFound("guest %s not found", name)
+	}
+	if len(path) == 2 {
+		switch method {
+		case "GET":
+			return guest, nil
+		case "PUT":
+			var update rest.Guest
+			if err := json.Unmarshal(body, &update); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			f.guests[name] = &update
+			return map[string]string{}, nil
+		case "DELETE":
+			if !guest.External {
+				return nil, badRequest("only external guests can be deleted")
+			}
+			delete(f.guests, name)
+			return map[string]string{}, nil
+		}
+	}
+	if len(path) == 3 && method == "POST" {
+		switch path[2] {
+		case "shutdown":
+			if !f.ignoreShutdown {
+				guest.GuestState = "stopped"
+				f.applyGuestDevices(guest)
+			}
+		case "poweroff":
+			guest.GuestState = "stopped"
+			f.applyGuestDevices(guest)
+		case "poweron", "reboot", "reset":
+			guest.GuestState = "ready"
+			f.applyGuestDevices(guest)
+		case "refresh":
+			f.refreshGuest(guest)
+		case "migrate":
+			var data map[string]string
+			json.Unmarshal(body, &data)
+			if _, ok := f.hosts[data["destinationId"]]; !ok {
+				return nil, badRequest("host %s not found", data["destinationId"])
+			}
+			if guest.GuestState != "ready" {
+				return nil, badRequest("guest %s is not running", name)
+			}
+			guest.Hostid = data["destinationId"]
+		case "resetRecord":
+			guest.GuestState = "ready"
+		case "delete":
+			delete(f.guests, name)
+		default:
+			return nil, notFound("unknown guest action %s", path[2])
+		}
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown guest request")
+}
+
+// routeBroker assigns pool guests to users and releases them.
+func (f *fakeHive) routeBroker(method string, path []string, body []byte) (interface{}, error) {
+	var data map[string]string
+	json.Unmarshal(body, &data)
+	switch {
+	case len(path) == 3 && path[1] == "assign" && method == "POST":
+		guest, ok := f.guests[data["guestName"]]
+		if !ok || guest.PoolID != path[2] {
+			return nil, notFound("guest %s not found in pool %s", data["guestName"], path[2])
+		}
+		if guest.Username != "" {
+			return nil, badRequest("guest %s is assigned to %s", guest.Name, guest.Username)
+		}
+		guest.Username = data["username"]
+		guest.Realm = data["realm"]
+		return map[string]string{"guest": guest.Name}, nil
+	case len(path) == 2 && path[1] == "release" && method == "POST":
+		guest, ok := f.guests[data["guest"]]
+		if !ok || guest.PoolID != data["poolId"] {
+			return nil, notFound("guest %s not found in pool %s", data["guest"], data["poolId"])
+		}
+		if guest.Username != data["username"] {
+			return nil, badRequest("guest %s is not assigned to %s", guest.Name, data["username"])
+		}
+		guest.Username = ""
+		guest.Realm = ""
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown broker request")
+}
+
+func (f *fakeHive) routeTemplate(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if len(path) == 2 && path[1] == "convert" && method == "POST" {
+		var data map[string]string
+		json.Unmarshal(body, &data)
+		src, ok := f.disks[data["srcStorage"]][data["srcFilename"]]
+		if !ok {
+			return nil, notFound("disk %s not found", data["srcFilename"])
+		}
+		if _, ok := f.disks[data["dstStorage"]]; !ok {
+			return nil, notFound("storage pool %s not found", data["dstStorage"])
+		}
+		return f.startTask("convert disk", "", func() error {
+			f.disks[data["dstStorage"]][data["dstFilename"]] = &rest.DiskInfo{
+				Filename:    data["dstFilename"],
+				Format:      data["output"],
+				VirtualSize: src.VirtualSize,
+			}
+			return nil
+		}), nil
+	}
+	if path[0] == "templates" {
+		switch method {
+		case "GET":
+			var templates []interface{}
+			for _, name := range sortedKeys(f.templates) {
+				templates = append(templates, f.templates[name])
+			}
+			return filterRecords(templates, query), nil
+		case "POST":
+			var template rest.Template
+			if err := json.Unmarshal(body, &template); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			if _, ok := f.templates[template.Name]; ok {
+				return nil, &fakeError{http.StatusConflict, "ConflictError", "template " + template.Name + " already exists"}
+			}
+			template.State = "analyzed"
+			f.templates[template.Name] = &template
+			return map[string]string{}, nil
+		}
+	}
+	name, _ := url.PathUnescape(path[1])
+	template, ok := f.templates[name]
+	if !ok {
+		return nil, notFound("template %s not found", name)
+	}
+	switch {
+	case len(path) == 2 && method == "GET":
+		return template, nil
+	case len(path) == 2 && method == "PUT":
+		var update rest.Template
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		update.State = template.State
+		f.templates[name] = &update
+		return map[string]string{}, nil
+	case len(path) == 2 && method == "DELETE":
+		for _, pool := range f.pools {
+			if pool.GuestProfile != nil && pool.GuestProfile.TemplateName == name {
+				return nil, locked("template %s is in use by pool %s", name, pool.Name)
+			}
+		}
+		delete(f.templates, name)
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown template request")
+}
+
+func (f *fakeHive) routeStorage(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "pools" {
+		switch method {
+		case "GET":
+			var pools []interface{}
+			for _, id := range sortedKeys(f.storagePools) {
+				pools = append(pools, f.storagePools[id])
+			}
+			return filterRecords(pools, query), nil
+		case "POST":
+			var storage rest.StoragePool
+			if err := json.Unmarshal(body, &storage); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			storage.ID = uuid.New().String()
+			f.storagePools[storage.ID] = &storage
+			f.disks[storage.ID] = map[string]*rest.DiskInfo{}
+			return map[string]string{"id": storage.ID}, nil
+		}
+	}
+	if len(path) < 2 || path[0] != "pool" {
+		return nil, notFound("unknown storage request")
+	}
+	storage, ok := f.storagePools[path[1]]
+	if !ok {
+		return nil, notFound("storage pool %s not found", path[1])
+	}
+	disks := f.disks[storage.ID]
+	var data map[string]interface{}
+	json.Unmarshal(body, &data)
+	filePath, _ := data["filePath"].(string)
+	if len(path) == 2 {
+		switch method {
+		case "GET":
+			return storage, nil
+		case "DELETE":
+			if len(disks) > 0 {
+				return nil, locked("Storage pool %s is in use and can not be deleted", storage.Name)
+			}
+			delete(f.storagePools, storage.ID)
+			delete(f.disks, storage.ID)
+			return map[string]string{}, nil
+		}
+	}
+	if len(path) == 3 && method == "DELETE" {
+		filename, _ := url.PathUnescape(path[2])
+		if _, ok := disks[filename]; !ok {
+			return nil, notFound("file %s not found", filename)
+		}
+		delete(disks, filename)
+		delete(f.contents, storage.ID+"/"+filename)
+		return map[string]bool{"deleted": true}, nil
+	}
+	if len(path) == 3 && path[2] == "download" && method == "GET" {
+		filename := query.Get("filePath")
+		if _, ok := disks[filename]; !ok {
+			return nil, notFound("file %s not found", filename)
+		}
+		return fakeRaw(f.contents[storage.ID+"/"+filename]), nil
+	}
+	if len(path) != 3 || method != "POST" {
+		return nil, notFound("unknown storage request")
+	}
+	switch path[2] {
+	case "diskInfo":
+		disk, ok := disks[filePath]
+		if !ok {
+			return nil, notFound("file %s not found", filePath)
+		}
+		return disk, nil
+	case "createDisk":
+		filename := data["filename"].(string)
+		size := uint(data["size"].(float64))
+		format := data["format"].(string)
+		if _, ok := disks[filename]; ok {
+			return nil, badRequest("file %s already exists", filename)
+		}
+		return f.startTask("create disk", "", func() error {
+			disks[filename] = &rest.DiskInfo{Filename: filename, Format: format, VirtualSize: size * gigabyte}
+			return nil
+		}), nil
+	case "copyUrl":
+		u := data["url"].(string)
+		return f.startTask("copy url", "", func() error {
+			if strings.Contains(u, "missing") {
+				return fmt.Errorf("failed to download %s: 404 Not Found", u)
+			}
+			disks[filePath] = &rest.DiskInfo{Filename: filePath, Format: "qcow2", VirtualSize: 2 * gigabyte}
+			f.contents[storage.ID+"/"+filePath] = []byte("image " + u)
+			return nil
+		}), nil
+	case "growDisk":
+		disk, ok := disks[filePath]
+		if !ok {
+			return nil, notFound("file %s not found", filePath)
+		}
+		size := uint(data["size"].(float64))
+		return f.startTask("grow disk", "", func() error {
+			disk.VirtualSize += size * gigabyte
+			return nil
+		}), nil
+	}
+	return nil, notFound("unknown storage request")
+}
+
+// verifyRealm checks the service account of a realm that is saved as
+// verified against adPassword.
+func (f *fakeHive) verifyRealm(realm *rest.Realm) {
+	if realm.Verified && f.adPassword != "" {
+		realm.Verified = realm.ServiceAccount != nil && realm.ServiceAccount.Password == f.adPassword
+	}
+}
+
+func (f *fakeHive) routeRealm(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "realms" {
+		switch method {
+		case "GET":
+			var realms []interface{}
+			for _, name := range sortedKeys(f.realms) {
+				realms = append(realms, f.realms[name])
+			}
+			return filterRecords(realms, query), nil
+		case "POST":
+			var realm rest.Realm
+			if err := json.Unmarshal(body, &realm); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			if _, ok := f.realms[realm.Name]; ok {
+				return nil, &fakeError{http.StatusConflict, "ConflictError", "realm " + realm.Name + " already exists"}
+			}
+			f.verifyRealm(&realm)
+			f.realms[realm.Name] = &realm
+			return map[string]string{}, nil
+		}
+	}
+	realm, ok := f.realms[path[1]]
+	if !ok {
+		return nil, notFound("realm %s not found", path[1])
+	}
+	switch method {
+	case "GET":
+		// the service account password is not returned
+		result := *realm
+		if realm.ServiceAccount != nil {
+			result.ServiceAccount = &rest.RealmServiceAccount{Username: realm.ServiceAccount.Username}
+		}
+		return result, nil
+	case "PUT":
+		var update rest.Realm
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		f.verifyRealm(&update)
+		f.realms[realm.Name] = &update
+		return map[string]string{}, nil
+	case "DELETE":
+		delete(f.realms, realm.Name)
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown realm request")
+}
+
+func (f *fakeHive) routeUser(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "users" {
+		switch method {
+		case "GET":
+			var users []interface{}
+			for _, id := range sortedKeys(f.users) {
+				users = append(users, f.users[id])
+			}
+			return filterRecords(users, query), nil
+		case "POST":
+			var user rest.User
+			if err := json.Unmarshal(body, &user); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			f.users[user.ID] = &user
+			return map[string]string{}, nil
+		}
+	}
+	user, ok := f.users[path[1]]
+	if !ok {
+		return nil, notFound("user %s not found", path[1])
+	}
+	switch method {
+	case "GET":
+		return user, nil
+	case "PUT":
+		var update rest.User
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		update.ID = user.ID
+		f.users[user.ID] = &update
+		return map[string]string{}, nil
+	case "DELETE":
+		delete(f.users, user.ID)
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown user request")
+}
+
+func (f *fakeHive) routeProfile(method string, path []string, query url.Values, body []byte) (interface{}, error) {
+	if path[0] == "profiles" {
+		switch method {
+		case "GET":
+			var profiles []interface{}
+			for _, id := range sortedKeys(f.profiles) {
+				profiles = append(profiles, f.profiles[id])
+			}
+			return filterRecords(profiles, query), nil
+		case "POST":
+			var profile rest.Profile
+			if err := json.Unmarshal(body, &profile); err != nil {
+				return nil, badRequest(err.Error())
+			}
+			profile.ID = uuid.New().String()
+			if profile.AdConfig != nil {
+				f.profilePasswords[profile.ID] = profile.AdConfig.Password
+				profile.AdConfig.Password = ""
+			}
+			f.profiles[profile.ID] = &profile
+			return map[string]string{"id": profile.ID}, nil
+		}
+	}
+	profile, ok := f.profiles[path[1]]
+	if !ok {
+		return nil, notFound("profile %s not found", path[1])
+	}
+	switch method {
+	case "GET":
+		return profile, nil
+	case "PUT":
+		var update rest.Profile
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, badRequest(err.Error())
+		}
+		update.ID = profile.ID
+		if update.AdConfig != nil && update.AdConfig.Password != "" {
+			f.profilePasswords[profile.ID] = update.AdConfig.Password
+			update.AdConfig.Password = ""
+		}
+		f.profiles[profile.ID] = &update
+		return map[string]string{}, nil
+	case "DELETE":
+		for _, pool := range f.pools {
+			if pool.ProfileID == profile.ID {
+				return nil, locked("profile %s is in use by pool %s", profile.Name, pool.Name)
+			}
+		}
+		delete(f.profiles, profile.ID)
+		return map[string]string{}, nil
+	}
+	return nil, notFound("unknown profile request")
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch records := m.(type) {
+	case map[string]*rest.Pool:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.Guest:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.Template:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.StoragePool:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.Realm:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.User:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	case map[string]*rest.Profile:
+		for k := range records {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// filterRecords returns the records with top level json fields matching
+// every query parameter, the way the rest api filters list requests.
+func filterRecords(records []interface{}, query url.Values) []interface{} {
+	filtered := []interface{}{}
+	for _, record := range records {
+		data, _ := json.Marshal(record)
+		var fields map[string]interface{}
+		json.Unmarshal(data, &fields)
+		match := true
+		for key := range query {
+			if fmt.Sprint(fields[key]) != query.Get(key) {
+				match = false
+			}
+		}
+		if match {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+var upgrader = websocket.Upgrader{}
+
+// serveChangeFeed implements enough of the socket.io changefeed protocol for
+// WaitForTask, WaitForPool and WaitForGuest. The current record is sent when
+// the feed is registered and again every time it changes.
+func (f *fakeHive) serveChangeFeed(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	token := f.token
+	f.mu.Unlock()
+	if r.URL.Query().Get("token") != token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, message, err := conn.ReadMessage()
+	if err != nil || !strings.HasPrefix(string(message), "42") {
+		return
+	}
+	var register []json.RawMessage
+	var options struct {
+		Table  string            `json:"table"`
+		Filter map[string]string `json:"filter"`
+	}
+	if json.Unmarshal(message[2:], &register) != nil || len(register) < 2 || json.Unmarshal(register[1], &options) != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var last string
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		f.mu.Lock()
+		var record interface{}
+		switch options.Table {
+		case "task":
+			record = f.tasks[options.Filter["id"]]
+		case "pool":
+			record = f.pools[options.Filter["id"]]
+		case "guest":
+			record = f.guests[options.Filter["name"]]
+		}
+		data, _ := json.Marshal(map[string]interface{}{"new_val": record})
+		f.mu.Unlock()
+
+		if string(data) != last {
+			last = string(data)
+			msg := fmt.Sprintf(`42["query:change:%s",null,%s]`, options.Table, data)
+			if conn.WriteMessage(websocket.TextMessage, []byte(msg)) != nil {
+				return
+			}
+		}
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package hiveio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// traceEnv enables logging of request and response bodies when it is set to
+// TRACE. The bodies are logged at the DEBUG level with sensitive fields
+// redacted, so TF_LOG has to be DEBUG or TRACE as well.
+const traceEnv = "TF_LOG_PROVIDER_HIVEIO"
+
+// maxTraceBody is the largest body that is traced, larger bodies are only
+// logged with their size.
+const maxTraceBody = 64 * 1024
+
+// sensitiveFields are redacted from traced bodies. Field names are matched
+// case insensitively by substring.
+var sensitiveFields = []string{"password", "secret", "token", "key", "userdata", "credential"}
+
+func traceEnabled() bool {
+	return strings.EqualFold(os.Getenv(traceEnv), "TRACE")
+}
+
+// withLogging logs the start, duration and result of the CRUD functions of a
+// resource or data source.
+func withLogging(name string, r *schema.Resource) *schema.Resource {
+	wrap := func(op string, fn func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics) func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics {
+		if fn == nil {
+			return nil
+		}
+		return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+			log.Printf("[DEBUG] %s: %s started", resourceLabel(name, d.Id()), op)
+			start := time.Now()
+			diags := fn(ctx, d, m)
+			duration := time.Since(start).Round(time.Millisecond)
+			for _, diagnostic := range diags {
+				if diagnostic.Severity == diag.Error {
+					log.Printf("[ERROR] %s: %s failed after %s: %s", resourceLabel(name, d.Id()), op, duration, diagnostic.Summary)
+					return diags
+				}
+			}
+			log.Printf("[DEBUG] %s: %s finished in %s", resourceLabel(name, d.Id()), op, duration)
+			return diags
+		}
+	}
+	r.CreateContext = wrap("create", r.CreateContext)
+	r.ReadContext = wrap("read", r.ReadContext)
+	r.UpdateContext = wrap("update", r.UpdateContext)
+	r.DeleteContext = wrap("delete", r.DeleteContext)
+	return r
+}
+
+func resourceLabel(name, id string) string {
+	if id == "" {
+		return name
+	}
+	return name + " " + id
+}
+
+// logCall logs the endpoint, status and duration of one attempt of a request
+// sent through the rest client. The rest client only returns the status of
+// failed requests, successful requests are logged without one.
+func logCall(endpoint string, attempt int, duration time.Duration, err error) {
+	if attempt > 0 {
+		endpoint = fmt.Sprintf("%s (attempt %d)", endpoint, attempt+1)
+	}
+	duration = duration.Round(time.Millisecond)
+	if apiErr, ok := parseAPIError(err); ok {
+		log.Printf("[DEBUG] hiveio: %s returned %d in %s", endpoint, apiErr.StatusCode, duration)
+		return
+	}
+	if err != nil {
+		log.Printf("[DEBUG] hiveio: %s failed after %s: %s", endpoint, duration, err)
+		return
+	}
+	log.Printf("[DEBUG] hiveio: %s succeeded in %s", endpoint, duration)
+}
+
+// loggingTransport logs the endpoint, status and duration of the requests the
+// provider sends itself, like logins and uploads. Requests sent
+// through the rest client are logged by logCall.
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.Method + " " + strings.TrimPrefix(req.URL.Path, "/api/")
+	if req.URL.RawQuery != "" {
+		endpoint += "?" + req.URL.RawQuery
+	}
+	trace := traceEnabled()
+	if trace && req.Body != nil && strings.Contains(req.Header.Get("Content-Type"), "json") {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if len(body) > 0 {
+			log.Printf("[DEBUG] hiveio: %s request: %s", endpoint, redactBody(body))
+		}
+	}
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("[DEBUG] hiveio: %s failed after %s: %s", endpoint, duration, err)
+		return nil, err
+	}
+	log.Printf("[DEBUG] hiveio: %s returned %d in %s", endpoint, res.StatusCode, duration)
+	if trace && strings.Contains(res.Header.Get("Content-Type"), "json") && res.ContentLength <= maxTraceBody {
+		// chunked responses have no length, only read as much as is traced
+		body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxTraceBody+1))
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		if len(body) > maxTraceBody {
+			log.Printf("[DEBUG] hiveio: %s response: <more than %d bytes>", endpoint, maxTraceBody)
+		} else {
+			log.Printf("[DEBUG] hiveio: %s response: %s", endpoint, redactBody(body))
+		}
+	}
+	return res, nil
+}
+
+// redactBody returns a json body with the values of sensitive fields
+// replaced, other bodies are replaced by their size.
+func redactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("<%s, %d bytes>", http.DetectContentType(body), len(body))
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(redactValue(v))
+	redacted := strings.TrimSpace(buf.String())
+	if len(redacted) > maxTraceBody {
+		return redacted[:maxTraceBody] + "..."
+	}
+	return redacted
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, field := range value {
+			if isSensitiveField(k) && field != nil && field != "" {
+				value[k] = "<redacted>"
+			} else {
+				value[k] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redactValue(value[i])
+		}
+	}
+	return v
+}
+
+func isSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range sensitiveFields {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package hiveio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestRedactBody(t *testing.T) {
+	body := `{"name":"cifs1","password":"s3cr3t","s3SecretAccessKey":"abc","guestProfile":{"cloudInit":{"userData":"#cloud-config"}},"roles":[{"token":"t"}],"empty":""}`
+	redacted := redactBody([]byte(body))
+	for _, secret := range []string{"s3cr3t", "abc", "#cloud-config", `"t"`} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("%s was not redacted from %s", secret, redacted)
+		}
+	}
+	if !strings.Contains(redacted, `"name":"cifs1"`) {
+		t.Errorf("expected other fields to be kept: %s", redacted)
+	}
+	if redacted := redactBody([]byte("plain text")); redacted != "<text/plain; charset=utf-8, 10 bytes>" {
+		t.Errorf("expected the size of a body that is not json, got %s", redacted)
+	}
+}
+
+func TestRequestTrace(t *testing.T) {
+	fake := newFakeHive(t)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	os.Setenv(traceEnv, "TRACE")
+	defer func() {
+		os.Unsetenv(traceEnv)
+		log.SetOutput(ioutil.Discard)
+	}()
+
+	provider := testProvider(t, fake)
+	r := provider.ResourcesMap["hiveio_storage_pool"]
+	d := r.TestResourceData()
+	d.Set("name", "cifs1")
+	d.Set("type", "cifs")
+	d.Set("server", "nas.example.com")
+	d.Set("path", "share")
+	d.Set("username", "hive")
+	d.Set("password", "s3cr3t")
+	d.Set("roles", []interface{}{"backup"})
+	if diags := r.CreateContext(context.Background(), d, provider.Meta()); diags.HasError() {
+		t.Fatal(diagsError(diags))
+	}
+	fake.addDisk(d.Id(), "cloud.qcow2", "qcow2", 20)
+	client := provider.Meta().(*hiveClient)
+	var buf bytes.Buffer
+	if err := client.download(context.Background(), d.Id(), "cloud.qcow2", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	output := logs.String()
+	for _, line := range []string{
+		"[DEBUG] hiveio: POST auth request: ",
+		`"password":"<redacted>"`,
+		"[DEBUG] hiveio: POST auth returned 200",
+		`"token":"<redacted>"`,
+		"[DEBUG] hiveio_storage_pool: create started",
+		"[DEBUG] hiveio: POST storage/pools succeeded in ",
+		"[DEBUG] hiveio: GET storage/pool/" + d.Id() + " succeeded in ",
+		"[DEBUG] hiveio_storage_pool " + d.Id() + ": create finished",
+		"[DEBUG] hiveio: GET storage/pool/" + d.Id() + "/download?filePath=cloud.qcow2 succeeded in ",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("expected %q in the log:\n%s", line, output)
+		}
+	}
+	if strings.Contains(output, "s3cr3t") {
+		t.Errorf("password was logged:\n%s", output)
+	}
+}
+
+func TestCallLogsEveryAttempt(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	client := testClient(t, fake)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(ioutil.Discard)
+
+	fake.failNext("GET", "storage/pool/"+storage.ID, 503, "Service Unavailable")
+	err := client.call(context.Background(), "GET storage/pool/"+storage.ID, func(c *rest.Client) error {
+		_, err := c.GetStoragePool(storage.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.call(context.Background(), "GET storage/pool/missing", func(c *rest.Client) error {
+		_, err := c.GetStoragePool("missing")
+		return err
+	})
+	if !isNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	output := logs.String()
+	for _, line := range []string{
+		"[DEBUG] hiveio: GET storage/pool/" + storage.ID + " returned 503 in ",
+		"[DEBUG] hiveio: GET storage/pool/" + storage.ID + " (attempt 2) succeeded in ",
+		"[DEBUG] hiveio: GET storage/pool/missing returned 404 in ",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("expected %q in the log:\n%s", line, output)
+		}
+	}
+}
+
+func TestRequestTraceChunkedResponse(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("a", maxTraceBody) + `"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body[:10]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[10:]))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	os.Setenv(traceEnv, "TRACE")
+	defer func() {
+		os.Unsetenv(traceEnv)
+		log.SetOutput(ioutil.Discard)
+	}()
+
+	client := &http.Client{Transport: &loggingTransport{next: http.DefaultTransport}}
+	res, err := client.Get(server.URL + "/api/guests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.ContentLength != -1 {
+		t.Fatalf("expected a chunked response, got a length of %d", res.ContentLength)
+	}
+	received, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != body {
+		t.Errorf("expected the whole body of %d bytes, got %d bytes", len(body), len(received))
+	}
+	if expected := fmt.Sprintf("GET guests response: <more than %d bytes>", maxTraceBody); !strings.Contains(logs.String(), expected) {
+		t.Errorf("expected %q in the log:\n%s", expected, logs.String())
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/hive-io/hive-go-client/rest"
 )
 
 func init() {
@@ -38,7 +38,7 @@ func init() {
 
 //Provider hiveio terraform provider
 func Provider() *schema.Provider {
-	return &schema.Provider{
+	p := &schema.Provider{
 
 		Schema: map[string]*schema.Schema{
 			"username": {
@@ -80,11 +80,44 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("HIO_INSECURE", false),
 				Description: "Ignore SSL certificate errors.",
 			},
+			"default_timeouts": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Timeouts used by every resource that does not set its own `timeouts` block, for example to allow more time on large clusters.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"create": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDuration,
+							Description:  "Timeout for creating resources, such as `30m`.",
+						},
+						"update": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDuration,
+							Description:  "Timeout for updating resources, such as `30m`.",
+						},
+						"delete": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateDuration,
+							Description:  "Timeout for deleting resources, such as `30m`.",
+						},
+					},
+				},
+			},
 		},
 		DataSourcesMap: map[string]*schema.Resource{
 			"hiveio_profile":      dataSourceProfile(),
 			"hiveio_storage_pool": dataSourceStoragePool(),
 			"hiveio_host":         dataSourceHost(),
+			"hiveio_guests":       dataSourceGuests(),
+			"hiveio_guest_pool":   dataSourceGuestPool(),
+			"hiveio_template":     dataSourceTemplate(),
+			"hiveio_realm":        dataSourceRealm(),
+			"hiveio_networks":     dataSourceNetworks(),
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"hiveio_host":            resourceHost(),
@@ -99,17 +132,79 @@ func Provider() *schema.Provider {
 			"hiveio_external_guest":  resourceExternalGuest(),
 			"hiveio_user":            resourceUser(),
 			"hiveio_shared_storage":  resourceSharedStorage(),
+			"hiveio_cluster":         resourceCluster(),
+			"hiveio_guest":           resourceGuest(),
 		},
-
-		ConfigureFunc: providerConfigure,
 	}
+	p.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		setDefaultTimeouts(p, d)
+		return providerConfigure(d)
+	}
+	for name, r := range p.ResourcesMap {
+		withLogging(name, r)
+	}
+	for name, r := range p.DataSourcesMap {
+		withLogging(name, r)
+	}
+	return p
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	log.Printf("Connecting to %s", d.Get("host").(string))
+	log.Printf("[INFO] Connecting to %s", d.Get("host").(string))
+	return newHiveClient(
+		d.Get("host").(string),
+		uint(d.Get("port").(int)),
+		d.Get("insecure").(bool),
+		d.Get("username").(string),
+		d.Get("password").(string),
+		d.Get("realm").(string),
+	)
+}
+
+// setDefaultTimeouts replaces the built in timeouts of every resource with the
+// provider's default_timeouts. The timeouts block of a resource still takes
+// precedence because it is applied on top of these when the resource is
+// planned.
+func setDefaultTimeouts(p *schema.Provider, d *schema.ResourceData) {
+	for _, key := range []string{schema.TimeoutCreate, schema.TimeoutUpdate, schema.TimeoutDelete} {
+		value, ok := d.GetOk("default_timeouts.0." + key)
+		if !ok {
+			continue
+		}
+		timeout, err := time.ParseDuration(value.(string))
+		if err != nil {
+			continue
+		}
+		for _, r := range p.ResourcesMap {
+			if r.Timeouts == nil {
+				r.Timeouts = &schema.ResourceTimeout{}
+			}
+			switch key {
+			case schema.TimeoutCreate:
+				r.Timeouts.Create = &timeout
+			case schema.TimeoutUpdate:
+				if r.UpdateContext != nil {
+					r.Timeouts.Update = &timeout
+				}
+			case schema.TimeoutDelete:
+				r.Timeouts.Delete = &timeout
+			}
+		}
+	}
+}
 
-	client := &rest.Client{Host: d.Get("host").(string), Port: uint(d.Get("port").(int)), AllowInsecure: d.Get("insecure").(bool)}
-	err := client.Login(d.Get("username").(string), d.Get("password").(string), d.Get("realm").(string))
-	fmt.Println(err)
-	return client, err
+// validateDuration checks that a string is a duration such as 30m or 1h30m.
+func validateDuration(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	if timeout <= 0 {
+		return nil, []error{fmt.Errorf("%s must be positive, got %s", k, v)}
+	}
+	return nil, nil
 }
@@ -0,0 +1,405 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("TF_LOG") == "" {
+		log.SetOutput(ioutil.Discard)
+	}
+	// keep the saved upload urls out of the user's cache
+	cacheDir, err := ioutil.TempDir("", "hiveio-cache")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+	os.Setenv("HOME", cacheDir)
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
+
+func TestProvider(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProviderDefaultTimeouts(t *testing.T) {
+	fake := newFakeHive(t)
+	config := fake.providerConfig()
+	config["default_timeouts"] = []interface{}{
+		map[string]interface{}{"create": "2h", "delete": "45m"},
+	}
+	provider := Provider()
+	if diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(config)); diags.HasError() {
+		t.Fatal(diagsError(diags))
+	}
+
+	for name, r := range provider.ResourcesMap {
+		if *r.Timeouts.Create != 2*time.Hour || *r.Timeouts.Delete != 45*time.Minute {
+			t.Errorf("%s: expected the default create and delete timeouts, got %s and %s", name, *r.Timeouts.Create, *r.Timeouts.Delete)
+		}
+	}
+	disk := provider.ResourcesMap["hiveio_disk"]
+	if *disk.Timeouts.Update != 20*time.Minute {
+		t.Errorf("expected the update timeout of the disk to be kept, got %s", *disk.Timeouts.Update)
+	}
+
+	// the timeouts block of a resource overrides the provider defaults
+	timeouts := &schema.ResourceTimeout{}
+	err := timeouts.ConfigDecode(disk, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"timeouts": []interface{}{map[string]interface{}{"create": "3h"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *timeouts.Create != 3*time.Hour || *timeouts.Delete != 45*time.Minute {
+		t.Errorf("expected create 3h and delete 45m, got %s and %s", *timeouts.Create, *timeouts.Delete)
+	}
+
+	config["default_timeouts"] = []interface{}{map[string]interface{}{"update": "soon"}}
+	if diags := Provider().Validate(terraform.NewResourceConfigRaw(config)); !diags.HasError() {
+		t.Error("expected an invalid duration to be rejected")
+	}
+}
+
+// lifecycleTest describes a create, update, import and destroy cycle of one
+// resource named "test" against the fake hive api.
+type lifecycleTest struct {
+	// Resource is the resource type, for example hiveio_realm.
+	Resource string
+	Steps    []lifecycleStep
+	// ImportStateVerifyIgnore lists attribute prefixes that can not be read
+	// back after an import, such as passwords.
+	ImportStateVerifyIgnore []string
+	// ImportStateIdFunc returns the import id, the resource id by default.
+	ImportStateIdFunc func(*terraform.InstanceState) string
+	// KeepsRemoteObject is set for resources that are only removed from the
+	// state on destroy because the api can not delete them.
+	KeepsRemoteObject bool
+	CheckDestroy      resource.TestCheckFunc
+}
+
+type lifecycleStep struct {
+	PreConfig   func()
+	Config      map[string]interface{}
+	Check       resource.TestCheckFunc
+	ExpectError *regexp.Regexp
+}
+
+// testLifecycle runs tc with resource.UnitTest when a terraform binary is
+// available and directly against the provider's resource functions otherwise.
+// Both plan again after every step and fail when the plan is not empty.
+func testLifecycle(t *testing.T, fake *fakeHive, tc lifecycleTest) {
+	t.Run("offline", func(t *testing.T) {
+		testLifecycleOffline(t, fake, tc)
+	})
+	t.Run("terraform", func(t *testing.T) {
+		if _, err := exec.LookPath("terraform"); err != nil && os.Getenv("TF_ACC_TERRAFORM_PATH") == "" {
+			t.Skip("terraform binary not found")
+		}
+		testLifecycleTerraform(t, fake, tc)
+	})
+}
+
+func testLifecycleTerraform(t *testing.T, fake *fakeHive, tc lifecycleTest) {
+	r := Provider().ResourcesMap[tc.Resource]
+	name := tc.Resource + ".test"
+	var steps []resource.TestStep
+	for _, step := range tc.Steps {
+		steps = append(steps, resource.TestStep{
+			PreConfig:   step.PreConfig,
+			Config:      testProviderHCL(fake) + testResourceHCL("resource", tc.Resource, r, step.Config),
+			Check:       step.Check,
+			ExpectError: step.ExpectError,
+		})
+	}
+	importStep := resource.TestStep{
+		ResourceName:            name,
+		ImportState:             true,
+		ImportStateVerify:       true,
+		ImportStateVerifyIgnore: tc.ImportStateVerifyIgnore,
+	}
+	if tc.ImportStateIdFunc != nil {
+		importStep.ImportStateIdFunc = func(s *terraform.State) (string, error) {
+			return tc.ImportStateIdFunc(s.RootModule().Resources[name].Primary), nil
+		}
+	}
+	steps = append(steps, importStep)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: map[string]func() (*schema.Provider, error){
+			"hiveio": func() (*schema.Provider, error) { return Provider(), nil },
+		},
+		CheckDestroy: tc.CheckDestroy,
+		Steps:        steps,
+	})
+}
+
+func testLifecycleOffline(t *testing.T, fake *fakeHive, tc lifecycleTest) {
+	ctx := context.Background()
+	provider := testProvider(t, fake)
+	meta := provider.Meta()
+	r := provider.ResourcesMap[tc.Resource]
+	name := tc.Resource + ".test"
+
+	var state *terraform.InstanceState
+	for i, step := range tc.Steps {
+		if step.PreConfig != nil {
+			step.PreConfig()
+		}
+		if state != nil {
+			state = testRefresh(t, r, state, meta)
+		}
+		config := terraform.NewResourceConfigRaw(step.Config)
+		err := diagsError(r.Validate(config))
+		if err == nil {
+			var diff *terraform.InstanceDiff
+			diff, err = r.Diff(ctx, state, config, meta)
+			if err == nil && diff != nil && !diff.Empty() {
+				newState, diags := r.Apply(ctx, state, diff, meta)
+				if newState != nil {
+					state = newState
+				}
+				err = diagsError(diags)
+			}
+		}
+		if step.ExpectError != nil {
+			if err == nil || !step.ExpectError.MatchString(err.Error()) {
+				t.Fatalf("step %d: expected error matching %s, got %v", i, step.ExpectError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+
+		state = testRefresh(t, r, state, meta)
+		if state == nil {
+			t.Fatalf("step %d: %s does not exist after apply", i, name)
+		}
+		diff, err := r.Diff(ctx, state, config, meta)
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		if diff != nil && !diff.Empty() {
+			t.Fatalf("step %d: plan not empty after apply:\n%s", i, testDiffString(diff))
+		}
+		if step.Check != nil {
+			if err := step.Check(testState(tc.Resource, state)); err != nil {
+				t.Fatalf("step %d: %s", i, err)
+			}
+		}
+	}
+	if state == nil {
+		return
+	}
+
+	id := state.ID
+	if tc.ImportStateIdFunc != nil {
+		id = tc.ImportStateIdFunc(state)
+	}
+	imported, err := provider.ImportState(ctx, &terraform.InstanceInfo{Id: name, Type: tc.Resource}, id)
+	if err != nil {
+		t.Fatalf("import %s: %s", id, err)
+	}
+	if len(imported) != 1 {
+		t.Fatalf("import %s: expected 1 resource, got %d", id, len(imported))
+	}
+	importedState := testRefresh(t, r, imported[0], meta)
+	if importedState == nil {
+		t.Fatalf("import %s: resource not found", id)
+	}
+	testImportStateVerify(t, state, importedState, tc.ImportStateVerifyIgnore)
+
+	_, diags := r.Apply(ctx, state, &terraform.InstanceDiff{Destroy: true}, meta)
+	if err := diagsError(diags); err != nil {
+		t.Fatalf("destroy: %s", err)
+	}
+	if refreshed := testRefresh(t, r, state, meta); refreshed != nil && !tc.KeepsRemoteObject {
+		t.Fatalf("%s %s still exists after destroy", name, state.ID)
+	}
+	if tc.CheckDestroy != nil {
+		if err := tc.CheckDestroy(testState(tc.Resource, state)); err != nil {
+			t.Fatalf("destroy: %s", err)
+		}
+	}
+}
+
+// testProvider returns a provider configured for the fake hive api.
+func testProvider(t *testing.T, fake *fakeHive) *schema.Provider {
+	provider := Provider()
+	diags := provider.Configure(context.Background(), terraform.NewResourceConfigRaw(fake.providerConfig()))
+	if err := diagsError(diags); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// testClient returns a client for the fake hive api.
+func testClient(t *testing.T, fake *fakeHive) *hiveClient {
+	return testProvider(t, fake).Meta().(*hiveClient)
+}
+
+func testRefresh(t *testing.T, r *schema.Resource, state *terraform.InstanceState, meta interface{}) *terraform.InstanceState {
+	refreshed, diags := r.RefreshWithoutUpgrade(context.Background(), state, meta)
+	if err := diagsError(diags); err != nil {
+		t.Fatalf("refresh: %s", err)
+	}
+	return refreshed
+}
+
+// testReadDataSource reads a data source named "test" with config.
+func testReadDataSource(t *testing.T, fake *fakeHive, dataSource string, config map[string]interface{}) (*terraform.State, error) {
+	ctx := context.Background()
+	provider := testProvider(t, fake)
+	r := provider.DataSourcesMap[dataSource]
+	c := terraform.NewResourceConfigRaw(config)
+	if err := diagsError(r.Validate(c)); err != nil {
+		return nil, err
+	}
+	diff, err := r.Diff(ctx, nil, c, provider.Meta())
+	if err != nil {
+		return nil, err
+	}
+	state, diags := r.ReadDataApply(ctx, diff, provider.Meta())
+	if err := diagsError(diags); err != nil {
+		return nil, err
+	}
+	return testState("data."+dataSource, state), nil
+}
+
+// testState wraps an instance state so resource.TestCheckFunc can be used
+// with it.
+func testState(resourceType string, instance *terraform.InstanceState) *terraform.State {
+	state := terraform.NewState()
+	state.RootModule().Resources[resourceType+".test"] = &terraform.ResourceState{
+		Type:     strings.TrimPrefix(resourceType, "data."),
+		Primary:  instance,
+		Provider: "provider.hiveio",
+	}
+	return state
+}
+
+func testImportStateVerify(t *testing.T, expected, actual *terraform.InstanceState, ignore []string) {
+	skip := func(k string) bool {
+		if k == "id" || k == "%" || strings.HasPrefix(k, "timeouts") {
+			return true
+		}
+		for _, prefix := range ignore {
+			if strings.HasPrefix(k, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	keys := map[string]bool{}
+	for k := range expected.Attributes {
+		keys[k] = true
+	}
+	for k := range actual.Attributes {
+		keys[k] = true
+	}
+	for k := range keys {
+		if skip(k) {
+			continue
+		}
+		if expected.Attributes[k] != actual.Attributes[k] {
+			t.Errorf("import: %s is %q, expected %q", k, actual.Attributes[k], expected.Attributes[k])
+		}
+	}
+}
+
+func testDiffString(diff *terraform.InstanceDiff) string {
+	var lines []string
+	for k, attr := range diff.Attributes {
+		lines = append(lines, fmt.Sprintf("  %s: %q => %q", k, attr.Old, attr.New))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// diagsError returns the first error in diags.
+func diagsError(diags diag.Diagnostics) error {
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			if d.Detail != "" {
+				return fmt.Errorf("%s: %s", d.Summary, d.Detail)
+			}
+			return fmt.Errorf("%s", d.Summary)
+		}
+	}
+	return nil
+}
+
+func testProviderHCL(fake *fakeHive) string {
+	return testBlockHCL(`provider "hiveio"`, Provider().Schema, fake.providerConfig(), "")
+}
+
+func testResourceHCL(kind, resourceType string, r *schema.Resource, config map[string]interface{}) string {
+	return testBlockHCL(fmt.Sprintf("%s %q \"test\"", kind, resourceType), r.Schema, config, "")
+}
+
+// testBlockHCL renders a raw config map as hcl, lists of resources in the
+// schema are rendered as nested blocks.
+func testBlockHCL(header string, s map[string]*schema.Schema, config map[string]interface{}, indent string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s {\n", indent, header)
+	var keys []string
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := config[k]
+		if sch, ok := s[k]; ok {
+			if elem, ok := sch.Elem.(*schema.Resource); ok {
+				for _, block := range v.([]interface{}) {
+					b.WriteString(testBlockHCL(k, elem.Schema, block.(map[string]interface{}), indent+"  "))
+				}
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "%s  %s = %s\n", indent, k, testValueHCL(v))
+	}
+	fmt.Fprintf(&b, "%s}\n", indent)
+	return b.String()
+}
+
+func testValueHCL(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, testValueHCL(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		var items []string
+		for k, item := range v {
+			items = append(items, fmt.Sprintf("%q = %s", k, testValueHCL(item)))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,328 @@
+package hiveio
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+// backupWindow is the time format of the cluster backup windows.
+var backupWindow = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9]$`)
+
+func resourceCluster() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Manage the settings of the cluster the provider is connected to. The existing cluster is adopted on create and left as it is on destroy.",
+		CreateContext: resourceClusterCreate,
+		ReadContext:   resourceClusterRead,
+		UpdateContext: resourceClusterUpdate,
+		DeleteContext: resourceClusterDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceClusterImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"broker": {
+				Description: "Broker settings, the current settings are kept when the block is left out.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				Computed:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"enabled": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"external": {
+							Description: "Allow connections from outside the cluster network through the gateway.",
+							Type:        schema.TypeBool,
+							Optional:    true,
+						},
+						"external_profile": {
+							Description: "Profile used for external connections.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"title": {
+							Description: "Title of the broker login page.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"disclaimer": {
+							Description: "Disclaimer shown on the broker login page.",
+							Type:        schema.TypeString,
+							Optional:    true,
+						},
+						"hide_realms": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"hide_release": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"passthrough_authentication": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"auto_connect_user_desktop": {
+							Description: "Connect users to their desktop after login when they only have one.",
+							Type:        schema.TypeBool,
+							Optional:    true,
+						},
+						"allow_physical": {
+							Description: "Allow connections to physical desktops.",
+							Type:        schema.TypeBool,
+							Optional:    true,
+						},
+						"main_color": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"text_color": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"background_color": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"button_text_color": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"backup": {
+				Description: "Window for automatic data protection, backups are disabled when the block is removed. The backup settings of a cluster adopted without the block are kept.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"start_window": {
+							Description:  "Start of the backup window in the format `01:00:00`.",
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringMatch(backupWindow, "must be in the format 01:00:00"),
+						},
+						"end_window": {
+							Description:  "End of the backup window in the format `05:00:00`.",
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringMatch(backupWindow, "must be in the format 05:00:00"),
+						},
+					},
+				},
+			},
+			"gateway": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"enabled": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"uri": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func brokerFromResource(d *schema.ResourceData) rest.Broker {
+	prefix := "broker.0."
+	return rest.Broker{
+		Enabled:                   d.Get(prefix + "enabled").(bool),
+		External:                  d.Get(prefix + "external").(bool),
+		ExternalProfile:           d.Get(prefix + "external_profile").(string),
+		Title:                     d.Get(prefix + "title").(string),
+		Disclaimer:                d.Get(prefix + "disclaimer").(string),
+		HideRealms:                d.Get(prefix + "hide_realms").(bool),
+		HideRelease:               d.Get(prefix + "hide_release").(bool),
+		PassthroughAuthentication: d.Get(prefix + "passthrough_authentication").(bool),
+		AutoConnectUserDesktop:    d.Get(prefix + "auto_connect_user_desktop").(bool),
+		AllowPhysical:             d.Get(prefix + "allow_physical").(bool),
+		MainColor:                 d.Get(prefix + "main_color").(string),
+		TextColor:                 d.Get(prefix + "text_color").(string),
+		BackgroundColor:           d.Get(prefix + "background_color").(string),
+		ButtonTextColor:           d.Get(prefix + "button_text_color").(string),
+	}
+}
+
+func resourceClusterCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var clusterID string
+	err := client.call(ctx, "GET host/clusterid", func(c *rest.Client) (err error) {
+		clusterID, err = c.ClusterID()
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(clusterID)
+	return resourceClusterApply(ctx, d, m, true)
+}
+
+func resourceClusterUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceClusterApply(ctx, d, m, false)
+}
+
+// resourceClusterApply saves the broker and backup settings. On create every
+// setting in the configuration is saved, on update only the changed ones.
+// Backups are only disabled when a configured backup block is removed.
+func resourceClusterApply(ctx context.Context, d *schema.ResourceData, m interface{}, create bool) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster/"+d.Id(), func(c *rest.Client) (err error) {
+		cluster, err = c.GetCluster(d.Id())
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+
+	if _, ok := d.GetOk("broker"); ok && (create || d.HasChange("broker")) {
+		broker := brokerFromResource(d)
+		err := client.call(ctx, "PUT cluster/"+cluster.ID+"/broker", func(c *rest.Client) error {
+			// Keep the images, they are not managed by the provider.
+			current, err := c.GetBroker(cluster.ID)
+			if err != nil {
+				return err
+			}
+			broker.BgImage, broker.BgImageFilename = current.BgImage, current.BgImageFilename
+			broker.Logo, broker.LogoFilename = current.Logo, current.LogoFilename
+			broker.Favicon, broker.FaviconFilename = current.Favicon, current.FaviconFilename
+			broker.TwoFormAuth = current.TwoFormAuth
+			return c.SetBroker(cluster.ID, broker)
+		})
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	_, backup := d.GetOk("backup")
+	enabled := cluster.Backup != nil && cluster.Backup.Enabled
+	if backup && (create || d.HasChange("backup")) {
+		err := client.callOnce(ctx, "POST cluster/"+cluster.ID+"/enableBackup", func(c *rest.Client) error {
+			return cluster.EnableBackup(c, d.Get("backup.0.start_window").(string), d.Get("backup.0.end_window").(string))
+		})
+		if err != nil {
+			return diagFromErr(err)
+		}
+	} else if !backup && d.HasChange("backup") && enabled {
+		err := client.callOnce(ctx, "POST cluster/"+cluster.ID+"/disableBackup", func(c *rest.Client) error {
+			return cluster.DisableBackup(c)
+		})
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+	return resourceClusterRead(ctx, d, m)
+}
+
+func resourceClusterRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var cluster rest.Cluster
+	var broker rest.Broker
+	err := client.call(ctx, "GET cluster/"+d.Id(), func(c *rest.Client) (err error) {
+		cluster, err = c.GetCluster(d.Id())
+		if err != nil {
+			return err
+		}
+		broker, err = c.GetBroker(cluster.ID)
+		return err
+	})
+	if isNotFound(err) {
+		d.SetId("")
+		return diag.Diagnostics{}
+	} else if err != nil {
+		return diagFromErr(err)
+	}
+	d.Set("name", cluster.Name)
+	d.Set("broker", []interface{}{
+		map[string]interface{}{
+			"enabled":                    broker.Enabled,
+			"external":                   broker.External,
+			"external_profile":           broker.ExternalProfile,
+			"title":                      broker.Title,
+			"disclaimer":                 broker.Disclaimer,
+			"hide_realms":                broker.HideRealms,
+			"hide_release":               broker.HideRelease,
+			"passthrough_authentication": broker.PassthroughAuthentication,
+			"auto_connect_user_desktop":  broker.AutoConnectUserDesktop,
+			"allow_physical":             broker.AllowPhysical,
+			"main_color":                 broker.MainColor,
+			"text_color":                 broker.TextColor,
+			"background_color":           broker.BackgroundColor,
+			"button_text_color":          broker.ButtonTextColor,
+		},
+	})
+	// backups are only tracked once the backup block is set
+	if _, ok := d.GetOk("backup"); ok {
+		d.Set("backup", flattenClusterBackup(cluster.Backup))
+	}
+	if cluster.Gateway != nil {
+		d.Set("gateway", []interface{}{
+			map[string]interface{}{
+				"enabled": cluster.Gateway.Enabled,
+				"uri":     cluster.Gateway.URI,
+			},
+		})
+	} else {
+		d.Set("gateway", nil)
+	}
+	return diag.Diagnostics{}
+}
+
+// resourceClusterImport starts tracking the backup settings when backups are
+// enabled.
+func resourceClusterImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	client := m.(*hiveClient)
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster/"+d.Id(), func(c *rest.Client) (err error) {
+		cluster, err = c.GetCluster(d.Id())
+		return err
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	d.Set("backup", flattenClusterBackup(cluster.Backup))
+	return []*schema.ResourceData{d}, nil
+}
+
+func flattenClusterBackup(backup *rest.ClusterBackup) []interface{} {
+	if backup == nil || !backup.Enabled {
+		return nil
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"start_window": backup.StartWindow,
+			"end_window":   backup.EndWindow,
+		},
+	}
+}
+
+func resourceClusterDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return diag.Diagnostics{}
+}
@@ -0,0 +1,134 @@
+package hiveio
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestResourceCluster(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_cluster",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "id", fake.cluster.ID),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "name", "test-cluster"),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "broker.0.title", "Hive"),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "gateway.0.uri", "wss://gateway.example.com"),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "backup.#", "0"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"broker": []interface{}{
+						map[string]interface{}{
+							"title":                     "Desktops",
+							"disclaimer":                "Authorized users only",
+							"hide_realms":               true,
+							"auto_connect_user_desktop": true,
+						},
+					},
+					"backup": []interface{}{
+						map[string]interface{}{
+							"start_window": "01:00:00",
+							"end_window":   "05:00:00",
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "broker.0.title", "Desktops"),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "broker.0.hide_realms", "true"),
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "backup.0.start_window", "01:00:00"),
+					testCheckClusterBroker(fake, "Desktops", "logo.png"),
+				),
+			},
+			{
+				PreConfig: func() {
+					fake.update(func() { fake.cluster.Broker.Title = "Changed" })
+				},
+				Config: map[string]interface{}{
+					"broker": []interface{}{
+						map[string]interface{}{
+							"title":                     "Desktops",
+							"disclaimer":                "Authorized users only",
+							"hide_realms":               true,
+							"auto_connect_user_desktop": true,
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_cluster.test", "backup.#", "0"),
+					testCheckClusterBroker(fake, "Desktops", "logo.png"),
+					func(s *terraform.State) error {
+						var enabled bool
+						fake.update(func() { enabled = fake.cluster.Backup.Enabled })
+						if enabled {
+							return fmt.Errorf("backup is still enabled")
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"backup": []interface{}{
+						map[string]interface{}{
+							"start_window": "1am",
+							"end_window":   "05:00:00",
+						},
+					},
+				},
+				ExpectError: regexp.MustCompile("must be in the format 01:00:00"),
+			},
+		},
+		KeepsRemoteObject: true,
+	})
+}
+
+func TestResourceClusterKeepsBackup(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.update(func() {
+		fake.cluster.Backup = &rest.ClusterBackup{Enabled: true, StartWindow: "02:00:00", EndWindow: "04:00:00"}
+	})
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_cluster",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{},
+				Check: func(s *terraform.State) error {
+					var enabled bool
+					fake.update(func() { enabled = fake.cluster.Backup.Enabled })
+					if !enabled {
+						return fmt.Errorf("backup was disabled")
+					}
+					return nil
+				},
+			},
+		},
+		// import starts tracking the backup settings
+		ImportStateVerifyIgnore: []string{"backup"},
+		KeepsRemoteObject:       true,
+	})
+}
+
+// testCheckClusterBroker checks the broker title of the fake cluster and that
+// the logo was kept.
+func testCheckClusterBroker(fake *fakeHive, title, logo string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		var actualTitle, actualLogo string
+		fake.update(func() {
+			actualTitle, actualLogo = fake.cluster.Broker.Title, fake.cluster.Broker.Logo
+		})
+		if actualTitle != title || actualLogo != logo {
+			return fmt.Errorf("broker title %q logo %q, expected %q %q", actualTitle, actualLogo, title, logo)
+		}
+		return nil
+	}
+}
@@ -1,25 +1,52 @@
 package hiveio
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
+// defaultDiskSize is the size in GB of a new empty disk without a size.
+const defaultDiskSize = 30
+
+// checksumClient downloads checksum files. Unlike http.DefaultClient it
+// gives up on servers that stop responding.
+var checksumClient = &http.Client{Timeout: 2 * time.Minute}
+
 func resourceDisk() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceDiskCreate,
 		ReadContext:   resourceDiskRead,
+		UpdateContext: resourceDiskUpdate,
 		DeleteContext: resourceDiskDelete,
+		CustomizeDiff: customdiff.All(resourceDiskSourceDiff, resourceDiskCustomizeDiff),
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceDiskImport,
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 		Schema: map[string]*schema.Schema{
 			"filename": {
@@ -34,18 +61,18 @@ func resourceDisk() *schema.Resource {
 				ForceNew:    true,
 			},
 			"size": {
-				Description: "Size of the disk in GB",
+				Description: "Size of the disk in GB. The disk is grown in place, it can not be shrunk. Defaults to the size of the copied or uploaded disk, and to 30 for an empty disk. A copied or uploaded disk can not be smaller than its source.",
 				Type:        schema.TypeInt,
 				Optional:    true,
-				Default:     30,
-				ForceNew:    true,
+				Computed:    true,
 			},
 			"format": {
-				Description: "File format (qcow2 or raw)",
-				Type:        schema.TypeString,
-				Optional:    true,
-				Default:     "qcow2",
-				ForceNew:    true,
+				Description:  "File format (qcow2 or raw)",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "qcow2",
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(diskFormats, false),
 			},
 			"src_storage": {
 				Description: "The storage pool id of an existing disk to copy.",
@@ -66,21 +93,32 @@ func resourceDisk() *schema.Resource {
 				ForceNew:    true,
 			},
 			"local_file": {
-				Description: "A local file to upload to the storage pool.",
+				Description: "A local file to upload to the storage pool. Interrupted uploads are resumed, also by a later apply while the file is unchanged.",
 				Type:        schema.TypeString,
 				Optional:    true,
 				ForceNew:    true,
 			},
+			"source_checksum": {
+				Description:  "Checksum of `src_url` or `local_file` as `sha256:<hex>` or `sha512:<hex>`, or as `sha256:<url>` of a SHASUMS file that lists the source. The disk is checked after it is copied and replaced when the checksum changes. The hive api has no checksum of its own, the check downloads the whole disk from the storage pool again, which takes as long as a copy of its size and needs Hive Fabric 8.5 or newer.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateSourceChecksum,
+			},
 		},
 	}
 }
 
 func resourceDiskCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	id := d.Get("storage_pool").(string)
 	filename := d.Get("filename").(string)
 	format := d.Get("format").(string)
-	size := uint(d.Get("size").(int))
+	size := uint(defaultDiskSize)
+	sizeValue, sizeOk := d.GetOk("size")
+	if sizeOk {
+		size = uint(sizeValue.(int))
+	}
 
 	srcPool, srcPoolOk := d.GetOk("src_storage")
 	srcFilename, srcFileOk := d.GetOk("src_filename")
@@ -90,58 +128,94 @@ func resourceDiskCreate(ctx context.Context, d *schema.ResourceData, m interface
 	var err error
 	var task *rest.Task
 	var storage *rest.StoragePool
-	storage, err = client.GetStoragePool(id)
+	err = client.call(ctx, "GET storage/pool/"+id, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(id)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	if localFileOk {
-		err = storage.Upload(client, localFile.(string), filename)
+	var algorithm, checksum string
+	if v, ok := d.GetOk("source_checksum"); ok {
+		source := localFile.(string)
+		if srcURLOk {
+			source = srcURL.(string)
+		}
+		algorithm, checksum, err = resolveChecksum(ctx, v.(string), source)
 		if err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
 	}
-	if srcPoolOk && srcFileOk {
+
+	switch {
+	case localFileOk:
+		if checksum != "" {
+			h := newChecksumHash(algorithm)
+			if err := hashFile(localFile.(string), h); err != nil {
+				return diagFromErr(err)
+			}
+			if sum := hex.EncodeToString(h.Sum(nil)); sum != checksum {
+				return diag.Errorf("%s checksum of %s is %s, expected %s", algorithm, localFile, sum, checksum)
+			}
+		}
+		err = client.upload(ctx, id, localFile.(string), filename)
+	case srcPoolOk && srcFileOk:
 		var srcStorage *rest.StoragePool
-		srcStorage, err = client.GetStoragePool(srcPool.(string))
+		err = client.call(ctx, "GET storage/pool/"+srcPool.(string), func(c *rest.Client) (err error) {
+			srcStorage, err = c.GetStoragePool(srcPool.(string))
+			return err
+		})
 		if err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
 		}
-		task, err = srcStorage.ConvertDisk(client, srcFilename.(string), id, filename, format)
-	} else if srcURLOk {
-		task, err = storage.CopyURL(client, srcURL.(string), filename)
-	} else {
-		task, err = storage.CreateDisk(client, filename, format, size)
+		err = client.callOnce(ctx, "POST template/convert", func(c *rest.Client) (err error) {
+			task, err = srcStorage.ConvertDisk(c, srcFilename.(string), id, filename, format)
+			return err
+		})
+	case srcURLOk:
+		err = client.callOnce(ctx, "POST storage/pool/"+id+"/copyUrl", func(c *rest.Client) (err error) {
+			task, err = storage.CopyURL(c, srcURL.(string), filename)
+			return err
+		})
+	default:
+		err = client.callOnce(ctx, "POST storage/pool/"+id+"/createDisk", func(c *rest.Client) (err error) {
+			task, err = storage.CreateDisk(c, filename, format, size)
+			return err
+		})
 	}
 
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	if task == nil {
+	if task == nil && !localFileOk {
 		return diag.Errorf("Failed to create disk: Task was not returned")
 	}
-	task, err = task.WaitForTask(client, false)
-	if err != nil {
-		return diag.FromErr(err)
-	}
-	if task.State == "failed" {
-		return diag.Errorf("Failed to Create disk: %s", task.Message)
+	if task != nil {
+		_, err = waitForTask(ctx, client, task, d.Timeout(schema.TimeoutCreate))
+		if err != nil {
+			return diagFromErr(err)
+		}
 	}
-	disk, err := storage.DiskInfo(client, filename)
-	if err != nil {
-		return diag.FromErr(err)
+	if checksum != "" {
+		h := newChecksumHash(algorithm)
+		if err := client.download(ctx, id, filename, h); err != nil {
+			return diagFromErr(err)
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != checksum {
+			deleteDiskFile(ctx, client, storage, filename)
+			return diag.Errorf("%s checksum of %s is %s, expected %s", algorithm, filename, sum, checksum)
+		}
 	}
-	gbSize := disk.VirtualSize / 1024 / 1024 / 1024
-	if (size - gbSize) > 0 {
-		task, err = storage.GrowDisk(client, filename, size-gbSize)
-		if err != nil {
-			return diag.FromErr(err)
+	if sizeOk {
+		err = growDisk(ctx, client, storage, filename, size, d.Timeout(schema.TimeoutCreate))
+		var smallErr *diskTooSmallError
+		if errors.As(err, &smallErr) {
+			// the disk is not in the state yet, a later apply would find the file
+			deleteDiskFile(ctx, client, storage, filename)
+			return diag.Errorf("size is %d GB but the source of %s is %d GB, set size to at least %d or remove it", size, filename, smallErr.size, smallErr.size)
 		}
-		task, err = task.WaitForTask(client, false)
 		if err != nil {
-			return diag.FromErr(err)
-		}
-		if task.State == "failed" {
-			return diag.Errorf("Failed to resize disk: %s", task.Message)
+			return diagFromErr(err)
 		}
 	}
 	d.SetId(id + "-" + filename)
@@ -149,38 +223,297 @@ func resourceDiskCreate(ctx context.Context, d *schema.ResourceData, m interface
 }
 
 func resourceDiskRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	id := d.Get("storage_pool").(string)
 	filename := d.Get("filename").(string)
-	storage, err := client.GetStoragePool(id)
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	var storage *rest.StoragePool
+	err := client.call(ctx, "GET storage/pool/"+id, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(id)
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	disk, err := storage.DiskInfo(client, filename)
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	var disk rest.DiskInfo
+	err = client.call(ctx, "POST storage/pool/"+id+"/diskInfo", func(c *rest.Client) (err error) {
+		// diskInfo is a POST but only reads the disk, it is safe to retry
+		disk, err = storage.DiskInfo(c, filename)
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.Set("size", disk.VirtualSize/1024/1024/1024)
 	d.Set("format", disk.Format)
 	return diag.Diagnostics{}
 }
 
+func resourceDiskUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var storage *rest.StoragePool
+	err := client.call(ctx, "GET storage/pool/"+d.Get("storage_pool").(string), func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(d.Get("storage_pool").(string))
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	err = growDisk(ctx, client, storage, d.Get("filename").(string), uint(d.Get("size").(int)), d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	return resourceDiskRead(ctx, d, m)
+}
+
+// growDisk grows a disk to size GB, disks that are already large enough are
+// left unchanged.
+func growDisk(ctx context.Context, client *hiveClient, storage *rest.StoragePool, filename string, size uint, timeout time.Duration) error {
+	var disk rest.DiskInfo
+	err := client.call(ctx, "POST storage/pool/"+storage.ID+"/diskInfo", func(c *rest.Client) (err error) {
+		// diskInfo is a POST but only reads the disk, it is safe to retry
+		disk, err = storage.DiskInfo(c, filename)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	gbSize := disk.VirtualSize / 1024 / 1024 / 1024
+	if size < gbSize {
+		return &diskTooSmallError{size: gbSize}
+	}
+	if size == gbSize {
+		return nil
+	}
+	var task *rest.Task
+	err = client.callOnce(ctx, "POST storage/pool/"+storage.ID+"/growDisk", func(c *rest.Client) (err error) {
+		task, err = storage.GrowDisk(c, filename, size-gbSize)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = waitForTask(ctx, client, task, timeout)
+	return err
+}
+
+// diskTooSmallError is returned by growDisk when the disk is already larger
+// than the requested size.
+type diskTooSmallError struct {
+	size uint
+}
+
+func (e *diskTooSmallError) Error() string {
+	return fmt.Sprintf("disk is %d GB, disks can only be grown", e.size)
+}
+
+// deleteDiskFile removes a disk that failed to be created. Errors are only
+// logged, the create already failed.
+func deleteDiskFile(ctx context.Context, client *hiveClient, storage *rest.StoragePool, filename string) {
+	err := client.call(ctx, "DELETE storage/pool/"+storage.ID+"/"+filename, func(c *rest.Client) error {
+		return storage.DeleteFile(c, filename)
+	})
+	if err != nil {
+		log.Printf("[WARN] Failed to delete %s: %s", filename, err)
+	}
+}
+
+// resourceDiskSourceDiff allows a single source for a disk: local_file,
+// src_url or src_storage with src_filename. A checksum needs a source to
+// check.
+func resourceDiskSourceDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	localFile, srcURL := diffIsSet(d, "local_file"), diffIsSet(d, "src_url")
+	srcStorage, srcFilename := diffIsSet(d, "src_storage"), diffIsSet(d, "src_filename")
+	if srcStorage != srcFilename {
+		return fmt.Errorf("src_storage and src_filename must be set together")
+	}
+	var sources []string
+	if localFile {
+		sources = append(sources, "local_file")
+	}
+	if srcURL {
+		sources = append(sources, "src_url")
+	}
+	if srcStorage {
+		sources = append(sources, "src_storage")
+	}
+	if len(sources) > 1 {
+		return fmt.Errorf("only one of local_file, src_url or src_storage can be set, got %s", strings.Join(sources, " and "))
+	}
+	if diffIsSet(d, "source_checksum") && !localFile && !srcURL {
+		return fmt.Errorf("source_checksum requires src_url or local_file")
+	}
+	return nil
+}
+
+// resourceDiskCustomizeDiff rejects a smaller size for a disk that is not
+// replaced, disks can only be grown. A size that is not configured keeps the
+// size of the disk and is not compared.
+func resourceDiskCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || !d.HasChange("size") {
+		return nil
+	}
+	for _, key := range []string{"filename", "storage_pool", "format", "src_storage", "src_filename", "src_url", "local_file", "source_checksum"} {
+		if d.HasChange(key) {
+			return nil
+		}
+	}
+	old, new := d.GetChange("size")
+	if new.(int) < old.(int) {
+		return fmt.Errorf("size can not be reduced from %d GB to %d GB, disks can only be grown", old.(int), new.(int))
+	}
+	return nil
+}
+
+// validateSourceChecksum checks that a checksum is an algorithm followed by
+// a hex digest or by the url of a checksum file.
+func validateSourceChecksum(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	algorithm, value, err := splitChecksum(v)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	if isChecksumURL(value) {
+		return nil, nil
+	}
+	if err := checkDigest(algorithm, value); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func splitChecksum(checksum string) (string, string, error) {
+	parts := strings.SplitN(checksum, ":", 2)
+	if len(parts) != 2 || newChecksumHash(strings.ToLower(parts[0])) == nil {
+		return "", "", fmt.Errorf("checksum must start with sha256: or sha512:")
+	}
+	return strings.ToLower(parts[0]), parts[1], nil
+}
+
+func isChecksumURL(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+func checkDigest(algorithm, digest string) error {
+	b, err := hex.DecodeString(digest)
+	if err != nil || len(b) != newChecksumHash(algorithm).Size() {
+		return fmt.Errorf("%q is not a %s digest", digest, algorithm)
+	}
+	return nil
+}
+
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// resolveChecksum returns the algorithm and the expected digest for source.
+// Checksum files are searched for the base name of source.
+func resolveChecksum(ctx context.Context, checksum, source string) (string, string, error) {
+	algorithm, value, err := splitChecksum(checksum)
+	if err != nil {
+		return "", "", err
+	}
+	if !isChecksumURL(value) {
+		return algorithm, strings.ToLower(value), nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", value, nil)
+	if err != nil {
+		return "", "", err
+	}
+	res, err := checksumClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to download checksums from %s: %s", value, res.Status)
+	}
+	name := filepath.Base(source)
+	if u, err := url.Parse(source); err == nil && isChecksumURL(source) {
+		name = path.Base(u.Path)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == name {
+			digest := strings.ToLower(fields[0])
+			if err := checkDigest(algorithm, digest); err != nil {
+				return "", "", err
+			}
+			return algorithm, digest, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", fmt.Errorf("no checksum for %s found in %s", name, value)
+}
+
+func hashFile(filename string, h hash.Hash) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// resourceDiskImport finds the storage pool and filename for an id of the form
+// <storage_pool>-<filename>.
+func resourceDiskImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	client := m.(*hiveClient)
+	var pools []rest.StoragePool
+	err := client.call(ctx, "GET storage/pools", func(c *rest.Client) (err error) {
+		pools, err = c.ListStoragePools("")
+		return err
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	for _, pool := range pools {
+		if strings.HasPrefix(d.Id(), pool.ID+"-") {
+			d.Set("storage_pool", pool.ID)
+			d.Set("filename", strings.TrimPrefix(d.Id(), pool.ID+"-"))
+			return []*schema.ResourceData{d}, nil
+		}
+	}
+	return nil, fmt.Errorf("no storage pool found for disk %s", d.Id())
+}
+
 func resourceDiskDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	id := d.Get("storage_pool").(string)
-	storage, err := client.GetStoragePool(id)
+	var storage *rest.StoragePool
+	err := client.call(ctx, "GET storage/pool/"+id, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(id)
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = storage.DeleteFile(client, d.Get("filename").(string))
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err = client.call(ctx, "DELETE storage/pool/"+id+"/"+d.Get("filename").(string), func(c *rest.Client) error {
+		return storage.DeleteFile(c, d.Get("filename").(string))
+	})
+	if isNotFound(err) {
 		return diag.Diagnostics{}
 	}
-	return diag.FromErr(err)
+	return diagFromErr(err)
 }
@@ -0,0 +1,303 @@
+package hiveio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceDisk(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	fake.addDisk(storage.ID, "base.qcow2", "qcow2", 20)
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "test.qcow2",
+					"src_storage":  storage.ID,
+				},
+				ExpectError: regexp.MustCompile("src_storage and src_filename must be set together"),
+			},
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "test.qcow2",
+					"src_url":      "http://images.example.com/test.qcow2",
+					"src_storage":  storage.ID,
+					"src_filename": "base.qcow2",
+				},
+				ExpectError: regexp.MustCompile("only one of local_file, src_url or src_storage can be set, got src_url and src_storage"),
+			},
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "test.qcow2",
+					"format":       "vmdk",
+				},
+				ExpectError: regexp.MustCompile(`expected format to be one of \[qcow2 raw\]`),
+			},
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "test.qcow2",
+					"size":         10,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_disk.test", "id", storage.ID+"-test.qcow2"),
+					resource.TestCheckResourceAttr("hiveio_disk.test", "size", "10"),
+					resource.TestCheckResourceAttr("hiveio_disk.test", "format", "qcow2"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "test.raw",
+					"format":       "raw",
+					"size":         30,
+					"src_storage":  storage.ID,
+					"src_filename": "base.qcow2",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_disk.test", "size", "30"),
+					resource.TestCheckResourceAttr("hiveio_disk.test", "format", "raw"),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"src_storage", "src_filename"},
+	})
+}
+
+func TestResourceDiskCopyURL(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "missing.qcow2",
+					"src_url":      "https://images.example.com/missing.qcow2",
+				},
+				ExpectError: regexp.MustCompile("404 Not Found"),
+			},
+			{
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "cloud.qcow2",
+					"src_url":      "https://images.example.com/cloud.qcow2",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_disk.test", "size", "2"),
+			},
+			{
+				// an image larger than the size of an empty disk is kept
+				PreConfig: func() {
+					fake.update(func() { fake.disks[storage.ID]["cloud.qcow2"].VirtualSize = 40 * gigabyte })
+				},
+				Config: map[string]interface{}{
+					"storage_pool": storage.ID,
+					"filename":     "cloud.qcow2",
+					"src_url":      "https://images.example.com/cloud.qcow2",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_disk.test", "size", "40"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"src_url"},
+	})
+}
+
+func TestResourceDiskSizeBelowSource(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	config := func(size int) map[string]interface{} {
+		return map[string]interface{}{
+			"storage_pool": storage.ID,
+			"filename":     "cloud.qcow2",
+			"src_url":      "https://images.example.com/cloud.qcow2",
+			"size":         size,
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				Config:      config(1),
+				ExpectError: regexp.MustCompile("size is 1 GB but the source of cloud.qcow2 is 2 GB, set size to at least 2"),
+			},
+			{
+				Config: config(5),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_disk.test", "size", "5"),
+					func(*terraform.State) error {
+						// the copy of the failed create was removed
+						if count := fake.requestCount("DELETE", "storage/pool/"+storage.ID+"/cloud.qcow2"); count != 1 {
+							return fmt.Errorf("expected the disk to be deleted once, got %d", count)
+						}
+						return nil
+					},
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"src_url"},
+	})
+}
+
+func TestResourceDiskGrow(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	config := func(size int) map[string]interface{} {
+		return map[string]interface{}{
+			"storage_pool": storage.ID,
+			"filename":     "data.qcow2",
+			"size":         size,
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				Config: config(10),
+			},
+			{
+				Config: config(25),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_disk.test", "size", "25"),
+					func(*terraform.State) error {
+						if fake.requestCount("POST", "storage/pool/"+storage.ID+"/createDisk") != 1 {
+							return fmt.Errorf("expected the disk to be grown in place")
+						}
+						if disk := fake.disk(storage.ID, "data.qcow2"); disk.VirtualSize != 25*gigabyte {
+							return fmt.Errorf("disk is %d bytes", disk.VirtualSize)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config:      config(20),
+				ExpectError: regexp.MustCompile("size can not be reduced from 25 GB to 20 GB"),
+			},
+		},
+	})
+}
+
+func TestResourceDiskSourceChecksum(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	srcURL := "https://images.example.com/cloud.qcow2"
+	sum := sha256.Sum256([]byte("image " + srcURL))
+	digest := hex.EncodeToString(sum[:])
+	sums := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  other.qcow2\n%s *cloud.qcow2\n", strings.Repeat("0", 64), digest)
+	}))
+	t.Cleanup(sums.Close)
+	config := func(checksum string) map[string]interface{} {
+		return map[string]interface{}{
+			"storage_pool":    storage.ID,
+			"filename":        "cloud.qcow2",
+			"src_url":         srcURL,
+			"source_checksum": checksum,
+		}
+	}
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				Config:      config("sha256:" + strings.Repeat("0", 64)),
+				ExpectError: regexp.MustCompile("sha256 checksum of cloud.qcow2 is " + digest),
+			},
+			{
+				PreConfig: func() {
+					if fake.disk(storage.ID, "cloud.qcow2") != nil {
+						t.Fatal("expected the disk to be deleted after a checksum mismatch")
+					}
+				},
+				Config: config("sha256:" + digest),
+				Check:  resource.TestCheckResourceAttr("hiveio_disk.test", "source_checksum", "sha256:"+digest),
+			},
+			{
+				Config: config("sha256:" + sums.URL + "/SHA256SUMS"),
+				Check:  resource.TestCheckResourceAttr("hiveio_disk.test", "size", "2"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"src_url", "source_checksum"},
+	})
+}
+
+func TestResourceDiskUploadResume(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	data := bytes.Repeat([]byte("hive"), 5*1024*1024/4)
+	f, err := ioutil.TempFile("", "disk*.qcow2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	f.Write(data)
+	f.Close()
+	sum := sha512.Sum512(data)
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_disk",
+		Steps: []lifecycleStep{
+			{
+				PreConfig: func() {
+					fake.update(func() {
+						fake.failUploadChunks = 1
+						fake.uploadOffsets = nil
+					})
+				},
+				Config: map[string]interface{}{
+					"storage_pool":    storage.ID,
+					"filename":        "upload.qcow2",
+					"size":            10,
+					"local_file":      f.Name(),
+					"source_checksum": "sha512:" + hex.EncodeToString(sum[:]),
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_disk.test", "size", "10"),
+					func(*terraform.State) error {
+						var offsets []int64
+						var contents []byte
+						fake.update(func() {
+							offsets = fake.uploadOffsets
+							contents = fake.contents[storage.ID+"/upload.qcow2"]
+						})
+						if !bytes.Equal(contents, data) {
+							return fmt.Errorf("uploaded %d of %d bytes", len(contents), len(data))
+						}
+						restarts := 0
+						for _, offset := range offsets {
+							if offset == 0 {
+								restarts++
+							}
+						}
+						if restarts != 1 || len(offsets) != 4 {
+							return fmt.Errorf("expected the upload to resume, chunks were sent at %v", offsets)
+						}
+						return nil
+					},
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"local_file", "source_checksum"},
+	})
+}
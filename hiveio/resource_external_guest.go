@@ -2,7 +2,6 @@ package hiveio
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
@@ -20,6 +19,7 @@ func resourceExternalGuest() *schema.Resource {
 			StateContext: schema.ImportStatePassthroughContext,
 		},
 		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
 			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
@@ -72,25 +72,32 @@ func guestFromResource(d *schema.ResourceData) rest.ExternalGuest {
 }
 
 func resourceExternalGuestCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	guest := guestFromResource(d)
 
-	_, err := guest.Create(client)
+	err := client.callOnce(ctx, "POST guest/external", func(c *rest.Client) error {
+		_, err := guest.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(guest.GuestName)
 	return resourceExternalGuestRead(ctx, d, m)
 }
 
 func resourceExternalGuestRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	guest, err := client.GetGuest(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	client := m.(*hiveClient)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+d.Id(), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	d.Set("name", guest.Name)
@@ -103,11 +110,20 @@ func resourceExternalGuestRead(ctx context.Context, d *schema.ResourceData, m in
 }
 
 func resourceExternalGuestDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	guest, err := client.GetGuest(d.Id())
+	client := m.(*hiveClient)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+d.Id(), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = guest.Delete(client)
-	return diag.FromErr(err)
+	err = client.callOnce(ctx, "DELETE guest/"+d.Id(), func(c *rest.Client) error {
+		return guest.Delete(c)
+	})
+	return diagFromErr(err)
 }
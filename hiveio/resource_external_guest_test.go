@@ -0,0 +1,39 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestResourceExternalGuest(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_external_guest",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":     "WORKSTATION1",
+					"address":  "10.0.0.50",
+					"username": "jdoe",
+					"realm":    "TEST",
+					"os":       "win10",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_external_guest.test", "id", "WORKSTATION1"),
+					resource.TestCheckResourceAttr("hiveio_external_guest.test", "address", "10.0.0.50"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":     "WORKSTATION1",
+					"address":  "10.0.0.51",
+					"username": "jdoe",
+					"realm":    "TEST",
+					"os":       "win10",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_external_guest.test", "address", "10.0.0.51"),
+			},
+		},
+	})
+}
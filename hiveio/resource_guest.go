@@ -0,0 +1,292 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func resourceGuest() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Manage a single guest of a pool. The guest is adopted on create and left in the pool on destroy. Standalone guests are managed with hiveio_virtual_machine.",
+		CreateContext: resourceGuestCreate,
+		ReadContext:   resourceGuestRead,
+		UpdateContext: resourceGuestUpdate,
+		DeleteContext: resourceGuestDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceGuestImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"assigned_user": {
+				Description: "The user the guest is assigned to. The guest is released when it is removed. A guest adopted without it keeps its current user.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"realm": {
+				Description: "The realm of assigned_user.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"power_state": {
+				Description:  "The power state of the guest, `running` or `stopped`. A guest suspended outside of terraform is read as `suspended` and powered on or shut down to match. A guest in any other state, for example building or failed, is read as `unknown`. `suspended` can not be configured because the hive api has no action to suspend a guest.",
+				Type:         schema.TypeString,
+				Default:      "running",
+				Optional:     true,
+				ValidateFunc: validatePowerState,
+			},
+			"graceful_shutdown_timeout": {
+				Description: "Seconds to wait for the guest to shut down before it is powered off.",
+				Type:        schema.TypeInt,
+				Default:     300,
+				Optional:    true,
+			},
+			"host_id": {
+				Description: "The host running the guest. When it is set the guest is migrated back to it.",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+			},
+			"rebuild_trigger": {
+				Description: "Any value, the guest is rebuilt from its pool when it changes.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"pool_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"ip_address": {
+				Description: "The first ip address reported by the guest agent.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"guest_state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"template_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceGuestCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	name := d.Get("name").(string)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+name, func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(name)
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	if err := checkPoolGuest(guest); err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(guest.Name)
+	return resourceGuestApply(ctx, d, client, guest, d.Timeout(schema.TimeoutCreate))
+}
+
+func resourceGuestUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+d.Id(), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(d.Id())
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutUpdate))
+	if d.HasChange("rebuild_trigger") {
+		if err := rebuildGuest(ctx, client, guest, time.Until(deadline)); err != nil {
+			return diagFromErr(err)
+		}
+	}
+	return resourceGuestApply(ctx, d, client, guest, time.Until(deadline))
+}
+
+// resourceGuestApply moves the guest when host_id changed, assigns it to
+// assigned_user and sets its power state. The assignment is left alone
+// while assigned_user is neither set nor removed, so adopting a guest does
+// not release its user.
+func resourceGuestApply(ctx context.Context, d *schema.ResourceData, client *hiveClient, guest *rest.Guest, timeout time.Duration) diag.Diagnostics {
+	deadline := time.Now().Add(timeout)
+	if hostID := d.Get("host_id").(string); d.HasChange("host_id") && hostID != "" && hostID != guest.Hostid {
+		if err := migrateGuest(ctx, client, guest, hostID, time.Until(deadline)); err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	user, realm := d.Get("assigned_user").(string), d.Get("realm").(string)
+	managed := user != "" || d.HasChange("assigned_user")
+	if managed && guest.Username != "" && (guest.Username != user || guest.Realm != realm) {
+		log.Printf("[INFO] Releasing guest %s from user %s", guest.Name, guest.Username)
+		err := client.callOnce(ctx, "POST broker/release", func(c *rest.Client) error {
+			return c.ReleaseGuest(guest.PoolID, guest.Username, guest.Name)
+		})
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+	if user != "" && (guest.Username != user || guest.Realm != realm) {
+		log.Printf("[INFO] Assigning guest %s to user %s", guest.Name, user)
+		err := client.callOnce(ctx, "POST broker/assign/"+guest.PoolID, func(c *rest.Client) error {
+			_, err := c.AssignGuest(guest.PoolID, user, realm, guest.Name)
+			return err
+		})
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+
+	if err := setVMPowerState(ctx, d, client, guest.Name, time.Until(deadline)); err != nil {
+		return diagFromErr(err)
+	}
+	return resourceGuestRead(ctx, d, client)
+}
+
+// rebuildGuest recreates guest from its pool and waits for it to be ready on
+// the template of the pool.
+func rebuildGuest(ctx context.Context, client *hiveClient, guest *rest.Guest, timeout time.Duration) error {
+	// Refresh deletes standalone guests instead of rebuilding them
+	if err := checkPoolGuest(guest); err != nil {
+		return err
+	}
+	var pool *rest.Pool
+	err := client.call(ctx, "GET pool/"+guest.PoolID, func(c *rest.Client) (err error) {
+		pool, err = c.GetPool(guest.PoolID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Rebuilding guest %s of pool %s", guest.Name, pool.Name)
+	err = client.callOnce(ctx, "POST guest/"+guest.Name+"/refresh", func(c *rest.Client) error {
+		return guest.Refresh(c)
+	})
+	if err != nil {
+		return err
+	}
+	if err := waitForPoolGuest(ctx, client, guest.Name, pool.GuestProfile.TemplateName, timeout); err != nil {
+		return err
+	}
+	return client.call(ctx, "GET guest/"+guest.Name, func(c *rest.Client) error {
+		current, err := c.GetGuest(guest.Name)
+		if err == nil {
+			*guest = *current
+		}
+		return err
+	})
+}
+
+// checkPoolGuest returns an error for guests that do not belong to a guest
+// pool. Standalone guests are the virtual machines of hiveio_virtual_machine.
+func checkPoolGuest(guest *rest.Guest) error {
+	if guest.Standalone {
+		return fmt.Errorf("guest %s is a standalone virtual machine, manage it with hiveio_virtual_machine", guest.Name)
+	}
+	if guest.PoolID == "" || guest.External {
+		return fmt.Errorf("guest %s is not part of a pool", guest.Name)
+	}
+	return nil
+}
+
+// migrateGuest moves a running guest to hostID and waits for the migration to
+// finish.
+func migrateGuest(ctx context.Context, client *hiveClient, guest *rest.Guest, hostID string, timeout time.Duration) error {
+	log.Printf("[INFO] Migrating guest %s from host %s to %s", guest.Name, guest.Hostid, hostID)
+	err := client.callOnce(ctx, "POST guest/"+guest.Name+"/migrate", func(c *rest.Client) error {
+		return guest.Migrate(c, hostID)
+	})
+	if err != nil {
+		return err
+	}
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var current *rest.Guest
+		err := client.call(ctx, "GET guest/"+guest.Name, func(c *rest.Client) (err error) {
+			current, err = c.GetGuest(guest.Name)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		if current.Hostid != hostID || current.MigrationProcessing {
+			return resource.RetryableError(fmt.Errorf("guest %s is migrating to host %s", guest.Name, hostID))
+		}
+		*guest = *current
+		return nil
+	})
+}
+
+func resourceGuestRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+d.Id(), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		d.SetId("")
+		return diag.Diagnostics{}
+	} else if err != nil {
+		return diagFromErr(err)
+	}
+	d.Set("name", guest.Name)
+	d.Set("pool_id", guest.PoolID)
+	// the user is only tracked once assigned_user is set
+	if d.Get("assigned_user").(string) != "" {
+		d.Set("assigned_user", guest.Username)
+		d.Set("realm", guest.Realm)
+	}
+	d.Set("power_state", guestPowerState(guest))
+	d.Set("host_id", guest.Hostid)
+	d.Set("ip_address", guestIPAddress(guest))
+	d.Set("guest_state", guest.GuestState)
+	d.Set("template_name", guest.TemplateName)
+	return diag.Diagnostics{}
+}
+
+// resourceGuestImport sets the arguments that are not stored in the guest to
+// their defaults and starts tracking the user of an assigned guest.
+func resourceGuestImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	client := m.(*hiveClient)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+d.Id(), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(d.Id())
+		return err
+	})
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if err := checkPoolGuest(guest); err != nil {
+		return nil, err
+	}
+	d.Set("assigned_user", guest.Username)
+	d.Set("realm", guest.Realm)
+	d.Set("graceful_shutdown_timeout", 300)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceGuestDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return diag.Diagnostics{}
+}
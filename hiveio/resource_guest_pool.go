@@ -3,12 +3,14 @@ package hiveio
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -18,11 +20,14 @@ func resourceGuestPool() *schema.Resource {
 		ReadContext:   resourceGuestPoolRead,
 		UpdateContext: resourceGuestPoolUpdate,
 		DeleteContext: resourceGuestPoolDelete,
+		CustomizeDiff: resourceGuestPoolCustomizeDiff,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceGuestPoolImport,
 		},
 		Timeouts: &schema.ResourceTimeout{
-			Delete: schema.DefaultTimeout(5 * time.Minute),
+			Create: schema.DefaultTimeout(60 * time.Minute),
+			Update: schema.DefaultTimeout(60 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -73,10 +78,11 @@ func resourceGuestPool() *schema.Resource {
 				ForceNew: true,
 			},
 			"storage_type": {
-				Type:     schema.TypeString,
-				Default:  "disk",
-				Optional: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Default:      "disk",
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(poolStorageTypes, false),
 			},
 			"storage_id": {
 				Type:     schema.TypeString,
@@ -95,8 +101,9 @@ func resourceGuestPool() *schema.Resource {
 							Required: true,
 						},
 						"frequency": {
-							Type:     schema.TypeString,
-							Required: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringInSlice(backupFrequency, false),
 						},
 						"target": {
 							Type:     schema.TypeString,
@@ -123,14 +130,55 @@ func resourceGuestPool() *schema.Resource {
 				},
 			},
 			"wait_for_build": {
-				Type:     schema.TypeBool,
-				Default:  false,
-				Optional: true,
+				Description: "Wait for the minimum number of guests to be ready after the pool is created. Guests that fail to build fail the apply.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
+			"state": {
+				Description: "The state of the pool.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"guest_count": {
+				Description: "The number of guests in the pool.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"ready_count": {
+				Description: "The number of guests in the pool that reached their target state.",
+				Type:        schema.TypeInt,
+				Computed:    true,
+			},
+			"rolling_update": {
+				Description: "Rebuild the guests of a non-persistent pool in batches when `template` changes. A rolling update that fails is resumed by the next apply, guests that were already rebuilt are skipped.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
+			"max_unavailable": {
+				Description:  "The number of guests rebuilt at the same time during a rolling update.",
+				Type:         schema.TypeInt,
+				Default:      1,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(1),
 			},
 		},
 	}
 }
 
+// resourceGuestPoolCustomizeDiff rejects a minimum density above the maximum.
+func resourceGuestPoolCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("density.0") || !d.NewValueKnown("density.1") {
+		return nil
+	}
+	min, max := d.Get("density.0").(int), d.Get("density.1").(int)
+	if min > max {
+		return fmt.Errorf("density minimum %d is larger than the maximum %d", min, max)
+	}
+	return nil
+}
+
 func poolFromResource(d *schema.ResourceData) *rest.Pool {
 	pool := rest.Pool{
 		Name:        d.Get("name").(string),
@@ -191,12 +239,16 @@ func poolFromResource(d *schema.ResourceData) *rest.Pool {
 }
 
 func resourceGuestPoolCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	pool := poolFromResource(d)
 
-	template, err := client.GetTemplate(pool.GuestProfile.TemplateName)
+	var template rest.Template
+	err := client.call(ctx, "GET template/"+pool.GuestProfile.TemplateName, func(c *rest.Client) (err error) {
+		template, err = c.GetTemplate(pool.GuestProfile.TemplateName)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	pool.GuestProfile.OS = template.OS
 	pool.GuestProfile.Vga = template.DisplayDriver
@@ -207,29 +259,42 @@ func resourceGuestPoolCreate(ctx context.Context, d *schema.ResourceData, m inte
 		pool.GuestProfile.Mem = []int{template.Mem, template.Mem}
 	}
 
-	_, err = pool.Create(client)
+	err = client.callOnce(ctx, "POST pools", func(c *rest.Client) error {
+		_, err := pool.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	pool, err = client.GetPoolByName(pool.Name)
+	err = client.call(ctx, "GET pools?name="+pool.Name, func(c *rest.Client) (err error) {
+		pool, err = c.GetPoolByName(pool.Name)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
+	d.SetId(pool.ID)
 	if d.Get("wait_for_build").(bool) {
-		pool.WaitForPool(client, "tracking", 60*time.Minute)
+		diags := waitForPoolBuild(ctx, client, pool, d.Timeout(schema.TimeoutCreate))
+		if diags.HasError() {
+			return append(diags, resourceGuestPoolRead(ctx, d, m)...)
+		}
 	}
-	d.SetId(pool.ID)
 	return resourceGuestPoolRead(ctx, d, m)
 }
 
 func resourceGuestPoolRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	pool, err := client.GetPool(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	client := m.(*hiveClient)
+	var pool *rest.Pool
+	err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+		pool, err = c.GetPool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	d.Set("name", pool.Name)
@@ -243,31 +308,136 @@ func resourceGuestPoolRead(ctx context.Context, d *schema.ResourceData, m interf
 	d.Set("seed", pool.Seed)
 	d.Set("storage_type", pool.StorageType)
 	d.Set("storage_id", pool.StorageID)
-	d.Set("density.0", pool.Density[0])
-	d.Set("density.1", pool.Density[1])
-	if pool.GuestProfile.CloudInit != nil {
-		d.Set("cloudinit_enabled", pool.GuestProfile.CloudInit.Enabled)
-		d.Set("cloudinit_userdata", pool.GuestProfile.CloudInit.UserData)
+	d.Set("density", pool.Density)
+	cloudInit := pool.GuestProfile.CloudInit
+	if cloudInit == nil {
+		cloudInit = &rest.PoolCloudInit{}
 	}
+	d.Set("cloudinit_enabled", cloudInit.Enabled)
+	d.Set("cloudinit_userdata", cloudInit.UserData)
 
-	if pool.Backup != nil {
-		d.Set("backup.0.enabled", pool.Backup.Enabled)
-		d.Set("backup.0.frequency", pool.Backup.Frequency)
-		d.Set("backup.0.target", pool.Backup.TargetStorageID)
-	}
+	d.Set("backup", flattenPoolBackup(pool.Backup))
 	if pool.PoolAffinity != nil && len(pool.PoolAffinity.AllowedHostIDs) > 0 {
 		d.Set("allowed_hosts", pool.PoolAffinity.AllowedHostIDs)
 	}
+
+	var guests []rest.Guest
+	err = client.call(ctx, "GET guests?poolId="+pool.ID, func(c *rest.Client) (err error) {
+		guests, err = c.ListGuests("poolId=" + pool.ID)
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	// the hiveio_guest_pool data source shares Read and has no rolling_update
+	if rolling, ok := d.Get("rolling_update").(bool); ok && rolling {
+		if template := outdatedTemplate(pool, guests); template != "" {
+			d.Set("template", template)
+		}
+	}
+	ready, _ := poolGuestStatus(guests)
+	d.Set("state", pool.State)
+	d.Set("guest_count", len(guests))
+	d.Set("ready_count", ready)
 	return diag.Diagnostics{}
 }
 
+// waitForPoolBuild waits until the pool tracks its guests and at least the
+// minimum density of guests is ready. Guests that fail to build stop the wait
+// with one error per guest.
+func waitForPoolBuild(ctx context.Context, client *hiveClient, pool *rest.Pool, timeout time.Duration) diag.Diagnostics {
+	var failed []rest.Guest
+	err := resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var current *rest.Pool
+		var guests []rest.Guest
+		err := client.call(ctx, "GET pool/"+pool.ID, func(c *rest.Client) (err error) {
+			current, err = c.GetPool(pool.ID)
+			if err != nil {
+				return err
+			}
+			guests, err = c.ListGuests("poolId=" + pool.ID)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		var ready int
+		ready, failed = poolGuestStatus(guests)
+		if len(failed) > 0 {
+			return resource.NonRetryableError(fmt.Errorf("%d guests of pool %s failed to build", len(failed), pool.Name))
+		}
+		if current.State != "tracking" || ready < current.Density[0] {
+			log.Printf("[INFO] Pool %s is %s, %d of %d guests are ready", pool.Name, current.State, ready, current.Density[0])
+			return resource.RetryableError(fmt.Errorf("pool %s is %s with %d of %d guests ready", pool.Name, current.State, ready, current.Density[0]))
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+	if len(failed) == 0 {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("Pool %s was not built", pool.Name),
+			Detail:   err.Error(),
+		}}
+	}
+	var diags diag.Diagnostics
+	for _, guest := range failed {
+		message := guest.GuestState
+		if guest.Error != nil {
+			message = guest.Error.Message
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("Guest %s of pool %s failed to build", guest.Name, pool.Name),
+			Detail:   message,
+		})
+	}
+	return diags
+}
+
+// poolGuestStatus returns the number of ready guests and the guests in an
+// error state.
+func poolGuestStatus(guests []rest.Guest) (int, []rest.Guest) {
+	var ready int
+	var failed []rest.Guest
+	for i := range guests {
+		guest := &guests[i]
+		switch {
+		case guest.Error != nil || guest.GuestState == "failed":
+			failed = append(failed, *guest)
+		case guestReady(guest):
+			ready++
+		}
+	}
+	return ready, failed
+}
+
+func flattenPoolBackup(backup *rest.PoolBackup) []interface{} {
+	if backup == nil {
+		return nil
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"enabled":   backup.Enabled,
+			"frequency": backup.Frequency,
+			"target":    backup.TargetStorageID,
+		},
+	}
+}
+
 func resourceGuestPoolUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	pool := poolFromResource(d)
 
-	template, err := client.GetTemplate(pool.GuestProfile.TemplateName)
+	var template rest.Template
+	err := client.call(ctx, "GET template/"+pool.GuestProfile.TemplateName, func(c *rest.Client) (err error) {
+		template, err = c.GetTemplate(pool.GuestProfile.TemplateName)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	pool.GuestProfile.OS = template.OS
 	pool.GuestProfile.Vga = template.DisplayDriver
@@ -277,40 +447,220 @@ func resourceGuestPoolUpdate(ctx context.Context, d *schema.ResourceData, m inte
 	if len(pool.GuestProfile.Mem) != 2 {
 		pool.GuestProfile.Mem = []int{template.Mem, template.Mem}
 	}
-	_, err = pool.Update(client)
+	err = client.call(ctx, "PUT pool/"+pool.ID, func(c *rest.Client) error {
+		_, err := pool.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	return resourceGuestPoolRead(ctx, d, m)
+	var diags diag.Diagnostics
+	if d.HasChange("template") && d.Get("rolling_update").(bool) {
+		diags = rollOutPoolTemplate(ctx, d, client, pool)
+		if diags.HasError() {
+			// keep the old template in the state so the next apply resumes
+			// the rolling update
+			old, _ := d.GetChange("template")
+			d.Set("template", old)
+			return diags
+		}
+	}
+	return append(diags, resourceGuestPoolRead(ctx, d, m)...)
+}
+
+// resourceGuestPoolImport sets the arguments that are not stored in the pool
+// to their defaults.
+func resourceGuestPoolImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	d.Set("wait_for_build", false)
+	d.Set("rolling_update", false)
+	d.Set("max_unavailable", 1)
+	return []*schema.ResourceData{d}, nil
+}
+
+// outdatedTemplate returns the template of a non-persistent guest that was
+// not rebuilt with the template of pool. Read keeps it as the template of an
+// unfinished rolling update, the next plan shows the template change again
+// and the apply resumes the rolling update.
+func outdatedTemplate(pool *rest.Pool, guests []rest.Guest) string {
+	for _, guest := range guests {
+		if !guest.Persistent && guest.TemplateName != "" && guest.TemplateName != pool.GuestProfile.TemplateName {
+			return guest.TemplateName
+		}
+	}
+	return ""
+}
+
+// rollOutPoolTemplate rebuilds the guests of pool max_unavailable at a time
+// and waits for each batch to be ready on the new template before starting
+// the next one. Persistent guests are left on their current template, guests
+// already on the new template are skipped.
+func rollOutPoolTemplate(ctx context.Context, d *schema.ResourceData, client *hiveClient, pool *rest.Pool) diag.Diagnostics {
+	var diags diag.Diagnostics
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutUpdate))
+	template := pool.GuestProfile.TemplateName
+
+	var guests []rest.Guest
+	err := client.call(ctx, "GET guests?poolId="+pool.ID, func(c *rest.Client) (err error) {
+		guests, err = c.ListGuests("poolId=" + pool.ID)
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	var rebuild []rest.Guest
+	for _, guest := range guests {
+		if guest.TemplateName == template {
+			continue
+		}
+		if guest.Persistent {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Persistent guest %s was not rebuilt", guest.Name),
+				Detail:   fmt.Sprintf("Guest %s keeps its current template until it is rebuilt manually.", guest.Name),
+			})
+			continue
+		}
+		rebuild = append(rebuild, guest)
+	}
+
+	var rebuilt []string
+	batchSize := d.Get("max_unavailable").(int)
+	for start := 0; start < len(rebuild); start += batchSize {
+		end := start + batchSize
+		if end > len(rebuild) {
+			end = len(rebuild)
+		}
+		batch := rebuild[start:end]
+		for i := range batch {
+			guest := &batch[i]
+			log.Printf("[INFO] Rebuilding guest %s of pool %s with template %s (%d/%d)", guest.Name, pool.Name, template, start+i+1, len(rebuild))
+			err = client.callOnce(ctx, "POST guest/"+guest.Name+"/refresh", func(c *rest.Client) error {
+				return guest.Refresh(c)
+			})
+			if err != nil {
+				return append(diags, rollOutError(pool, template, rebuilt, guest.Name, len(rebuild), err))
+			}
+		}
+		for _, guest := range batch {
+			err = waitForPoolGuest(ctx, client, guest.Name, template, time.Until(deadline))
+			if err != nil {
+				return append(diags, rollOutError(pool, template, rebuilt, guest.Name, len(rebuild), err))
+			}
+			rebuilt = append(rebuilt, guest.Name)
+		}
+		log.Printf("[INFO] Rebuilt %d/%d guests of pool %s", end, len(rebuild), pool.Name)
+	}
+
+	err = resource.RetryContext(ctx, time.Until(deadline), func() *resource.RetryError {
+		var current *rest.Pool
+		err := client.call(ctx, "GET pool/"+pool.ID, func(c *rest.Client) (err error) {
+			current, err = c.GetPool(pool.ID)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		if current.State != "tracking" {
+			return resource.RetryableError(fmt.Errorf("pool %s is %s", pool.Name, current.State))
+		}
+		return nil
+	})
+	if err != nil {
+		return append(diags, rollOutError(pool, template, rebuilt, "", len(rebuild), err))
+	}
+	return diags
+}
+
+// rollOutError reports the guests a rolling update rebuilt before it failed
+// and the guest that stopped it. failed is empty when the pool did not
+// return to tracking its guests.
+func rollOutError(pool *rest.Pool, template string, rebuilt []string, failed string, total int, err error) diag.Diagnostic {
+	detail := fmt.Sprintf("%d of %d guests were rebuilt with template %s", len(rebuilt), total, template)
+	if len(rebuilt) > 0 {
+		detail += " (" + strings.Join(rebuilt, ", ") + ")"
+	}
+	if failed != "" {
+		detail += fmt.Sprintf(", guest %s failed", failed)
+	}
+	return diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("Rolling update of pool %s failed", pool.Name),
+		Detail:   fmt.Sprintf("%s: %s\nThe next apply resumes the rolling update with the guests that were not rebuilt.", detail, classifyError(err)),
+	}
+}
+
+// waitForPoolGuest waits for a rebuilt guest to be ready on template.
+func waitForPoolGuest(ctx context.Context, client *hiveClient, name, template string, timeout time.Duration) error {
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var guest *rest.Guest
+		err := client.call(ctx, "GET guest/"+name, func(c *rest.Client) (err error) {
+			guest, err = c.GetGuest(name)
+			return err
+		})
+		if isNotFound(err) {
+			return resource.RetryableError(fmt.Errorf("guest %s is being rebuilt", name))
+		}
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		if guest.Error != nil {
+			return resource.NonRetryableError(fmt.Errorf("guest %s failed: %s", name, guest.Error.Message))
+		}
+		if guest.TemplateName != template || !guestReady(guest) {
+			return resource.RetryableError(fmt.Errorf("guest %s is %s", name, guest.GuestState))
+		}
+		return nil
+	})
+}
+
+// guestReady reports whether a guest has reached one of its target states.
+func guestReady(guest *rest.Guest) bool {
+	for _, state := range guest.TargetState {
+		if state == guest.GuestState {
+			return true
+		}
+	}
+	return false
 }
 
 func resourceGuestPoolDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	pool, err := client.GetPool(d.Id())
+	client := m.(*hiveClient)
+	var pool *rest.Pool
+	err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+		pool, err = c.GetPool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = pool.Delete(client)
+	err = client.call(ctx, "DELETE pool/"+d.Id(), func(c *rest.Client) error {
+		return pool.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
-		pool, err := client.GetPool(d.Id())
+		var pool *rest.Pool
+		err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+			pool, err = c.GetPool(d.Id())
+			return err
+		})
 		if err == nil && pool.State == "deleting" {
-			time.Sleep(5 * time.Second)
 			return resource.RetryableError(fmt.Errorf("deleting pool %s", d.Id()))
 		}
-		if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
-			time.Sleep(5 * time.Second)
+		if isNotFound(err) {
 			return nil
 		}
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
@@ -0,0 +1,225 @@
+package hiveio
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func testGuestPoolFake(t *testing.T) (*fakeHive, *rest.Profile) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	storage := fake.addStoragePool("templates")
+	fake.addDisk(storage.ID, "win10.qcow2", "qcow2", 40)
+	fake.addTemplate(rest.Template{
+		Name:          "win10",
+		OS:            "win10",
+		Vcpu:          2,
+		Mem:           4096,
+		DisplayDriver: "qxl",
+		Disks:         []*rest.TemplateDisk{{StorageID: storage.ID, Filename: "win10.qcow2", Type: "Disk", DiskDriver: "virtio", Format: "qcow2"}},
+		Interfaces:    []*rest.TemplateInterface{{Network: "prod", Emulation: "virtio"}},
+	})
+	return fake, fake.addProfile("default")
+}
+
+func TestResourceGuestPool(t *testing.T) {
+	fake, profile := testGuestPoolFake(t)
+	fake.buildDelay = 50 * time.Millisecond
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":     "test",
+					"density":  []interface{}{4, 2},
+					"template": "win10",
+					"profile":  profile.ID,
+					"seed":     "TEST",
+				},
+				ExpectError: regexp.MustCompile("density minimum 4 is larger than the maximum 2"),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":           "test",
+					"density":        []interface{}{2, 4},
+					"cpu":            2,
+					"memory":         4096,
+					"template":       "win10",
+					"profile":        profile.ID,
+					"seed":           "TEST",
+					"wait_for_build": true,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_guest_pool.test", "id"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "density.0", "2"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "density.1", "4"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "state", "tracking"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "guest_count", "2"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "ready_count", "2"),
+					func(s *terraform.State) error {
+						if fake.guest("TEST1") == nil || fake.guest("TEST2") == nil {
+							return fmt.Errorf("pool guests were not created")
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":     "test",
+					"density":  []interface{}{3, 4},
+					"cpu":      4,
+					"memory":   8192,
+					"template": "win10",
+					"profile":  profile.ID,
+					"seed":     "TEST",
+					"backup": []interface{}{
+						map[string]interface{}{
+							"enabled":   true,
+							"frequency": "daily",
+							"target":    "backup-pool",
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "density.0", "3"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "cpu", "4"),
+					resource.TestCheckResourceAttr("hiveio_guest_pool.test", "backup.0.target", "backup-pool"),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"wait_for_build"},
+	})
+}
+
+func TestResourceGuestPoolBuildFailure(t *testing.T) {
+	fake, profile := testGuestPoolFake(t)
+	fake.buildDelay = 50 * time.Millisecond
+	fake.buildErrors = map[string]string{"TEST2": "not enough space on storage pool disk"}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":           "test",
+					"density":        []interface{}{2, 4},
+					"template":       "win10",
+					"profile":        profile.ID,
+					"seed":           "TEST",
+					"wait_for_build": true,
+				},
+				ExpectError: regexp.MustCompile("Guest TEST2 of pool test failed to build"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"wait_for_build"},
+	})
+}
+
+func TestResourceGuestPoolRollingUpdate(t *testing.T) {
+	fake, profile := testGuestPoolFake(t)
+	fake.update(func() {
+		template := *fake.templates["win10"]
+		template.Name = "win10-patched"
+		fake.templates[template.Name] = &template
+	})
+	config := func(template string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":            "test",
+			"density":         []interface{}{5, 5},
+			"cpu":             2,
+			"memory":          4096,
+			"template":        template,
+			"profile":         profile.ID,
+			"seed":            "TEST",
+			"rolling_update":  true,
+			"max_unavailable": 2,
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: config("win10"),
+			},
+			{
+				Config: config("win10-patched"),
+				Check: func(*terraform.State) error {
+					for i := 1; i <= 5; i++ {
+						guest := fake.guest(fmt.Sprintf("TEST%d", i))
+						if guest.TemplateName != "win10-patched" || guest.GuestState != "ready" {
+							return fmt.Errorf("guest %s is %s on template %s", guest.Name, guest.GuestState, guest.TemplateName)
+						}
+					}
+					var maxRefreshing int
+					fake.update(func() { maxRefreshing = fake.maxRefreshing })
+					if maxRefreshing != 2 {
+						return fmt.Errorf("%d guests were rebuilt at the same time, expected 2", maxRefreshing)
+					}
+					return nil
+				},
+			},
+		},
+		ImportStateVerifyIgnore: []string{"rolling_update", "max_unavailable"},
+	})
+}
+
+func TestResourceGuestPoolRollingUpdateResumes(t *testing.T) {
+	fake, profile := testGuestPoolFake(t)
+	fake.update(func() {
+		template := *fake.templates["win10"]
+		template.Name = "win10-patched"
+		fake.templates[template.Name] = &template
+	})
+	config := func(template string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":            "test",
+			"density":         []interface{}{5, 5},
+			"cpu":             2,
+			"memory":          4096,
+			"template":        template,
+			"profile":         profile.ID,
+			"seed":            "TEST",
+			"rolling_update":  true,
+			"max_unavailable": 2,
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: config("win10"),
+			},
+			{
+				PreConfig: func() {
+					fake.failNext("POST", "guest/TEST3/refresh", 500, `{"message":"refresh failed"}`)
+				},
+				Config:      config("win10-patched"),
+				ExpectError: regexp.MustCompile(`(?s)Rolling update of pool test failed.*2 of 5 guests were rebuilt with template win10-patched \(TEST1, TEST2\), guest TEST3 failed`),
+			},
+			{
+				Config: config("win10-patched"),
+				Check: func(*terraform.State) error {
+					for i := 1; i <= 5; i++ {
+						guest := fake.guest(fmt.Sprintf("TEST%d", i))
+						if guest.TemplateName != "win10-patched" || guest.GuestState != "ready" {
+							return fmt.Errorf("guest %s is %s on template %s", guest.Name, guest.GuestState, guest.TemplateName)
+						}
+					}
+					for _, name := range []string{"TEST1", "TEST2"} {
+						if count := fake.requestCount("POST", "guest/"+name+"/refresh"); count != 1 {
+							return fmt.Errorf("guest %s was rebuilt %d times, expected once", name, count)
+						}
+					}
+					return nil
+				},
+			},
+		},
+		ImportStateVerifyIgnore: []string{"rolling_update", "max_unavailable"},
+	})
+}
@@ -0,0 +1,173 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestResourceGuest(t *testing.T) {
+	fake := newFakeHive(t)
+	host1 := fake.addHost("10.0.0.11")
+	host2 := fake.addHost("10.0.0.12")
+	fake.update(func() {
+		fake.pools["pool1"] = &rest.Pool{ID: "pool1", Name: "pool1", Seed: "DESK", Density: []int{2, 2}, GuestProfile: &rest.PoolGuestProfile{
+			TemplateName: "win10", Persistent: true,
+		}}
+		fake.buildGuests(fake.pools["pool1"])
+	})
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":          "DESK1",
+					"assigned_user": "alice",
+					"realm":         "example",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_guest.test", "id", "DESK1"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "pool_id", "pool1"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "assigned_user", "alice"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "power_state", "running"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "host_id", host1.Hostid),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "template_name", "win10"),
+					testCheckGuestUser(fake, "DESK1", "alice", "example"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":          "DESK1",
+					"assigned_user": "bob",
+					"realm":         "example",
+					"host_id":       host2.Hostid,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_guest.test", "assigned_user", "bob"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "host_id", host2.Hostid),
+					testCheckGuestUser(fake, "DESK1", "bob", "example"),
+				),
+			},
+			{
+				PreConfig: func() {
+					fake.update(func() { fake.pools["pool1"].GuestProfile.TemplateName = "win11" })
+				},
+				Config: map[string]interface{}{
+					"name":            "DESK1",
+					"host_id":         host2.Hostid,
+					"power_state":     "stopped",
+					"rebuild_trigger": "1",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_guest.test", "assigned_user", ""),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "power_state", "stopped"),
+					resource.TestCheckResourceAttr("hiveio_guest.test", "template_name", "win11"),
+					testCheckGuestUser(fake, "DESK1", "", ""),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"rebuild_trigger"},
+		KeepsRemoteObject:       true,
+	})
+}
+
+func TestResourceGuestKeepsUser(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	fake.update(func() {
+		fake.pools["pool1"] = &rest.Pool{ID: "pool1", Name: "pool1", Seed: "DESK", Density: []int{1, 1}, GuestProfile: &rest.PoolGuestProfile{
+			TemplateName: "win10", Persistent: true,
+		}}
+		fake.buildGuests(fake.pools["pool1"])
+		fake.guests["DESK1"].Username, fake.guests["DESK1"].Realm = "carol", "example"
+	})
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{"name": "DESK1"},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckNoResourceAttr("hiveio_guest.test", "assigned_user"),
+					testCheckGuestUser(fake, "DESK1", "carol", "example"),
+				),
+			},
+			{
+				Config:      map[string]interface{}{"name": "DESK1", "power_state": "suspended"},
+				ExpectError: regexp.MustCompile("can not be suspended"),
+			},
+		},
+		// import starts tracking the user
+		ImportStateVerifyIgnore: []string{"assigned_user", "realm"},
+		KeepsRemoteObject:       true,
+	})
+}
+
+func TestResourceGuestNotInPool(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.update(func() {
+		fake.guests["EXTERNAL"] = &rest.Guest{Name: "EXTERNAL", External: true, GuestState: "ready"}
+	})
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest",
+		Steps: []lifecycleStep{
+			{
+				Config:      map[string]interface{}{"name": "EXTERNAL"},
+				ExpectError: regexp.MustCompile("guest EXTERNAL is not part of a pool"),
+			},
+		},
+	})
+}
+
+func TestResourceGuestStandalone(t *testing.T) {
+	fake := newFakeHive(t)
+	standalone := &rest.Guest{Name: "VM1", PoolID: "vm1", Standalone: true, GuestState: "ready"}
+	fake.update(func() {
+		fake.pools["vm1"] = &rest.Pool{ID: "vm1", Name: "vm1", Type: "standalone", GuestProfile: &rest.PoolGuestProfile{}}
+		fake.guests["VM1"] = standalone
+	})
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_guest",
+		Steps: []lifecycleStep{
+			{
+				Config:      map[string]interface{}{"name": "VM1", "rebuild_trigger": "1"},
+				ExpectError: regexp.MustCompile("guest VM1 is a standalone virtual machine"),
+			},
+		},
+	})
+
+	// Refresh deletes standalone guests, a rebuild must not send it
+	guest := *standalone
+	err := rebuildGuest(context.Background(), testClient(t, fake), &guest, time.Minute)
+	if err == nil {
+		t.Fatal("expected the rebuild of a standalone guest to fail")
+	}
+	var exists bool
+	fake.update(func() {
+		_, exists = fake.guests["VM1"]
+	})
+	if !exists {
+		t.Fatal("standalone guest was deleted")
+	}
+}
+
+// testCheckGuestUser checks the user the guest is assigned to in the fake.
+func testCheckGuestUser(fake *fakeHive, name, username, realm string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		var actualUser, actualRealm string
+		fake.update(func() {
+			actualUser, actualRealm = fake.guests[name].Username, fake.guests[name].Realm
+		})
+		if actualUser != username || actualRealm != realm {
+			return fmt.Errorf("guest %s is assigned to %s@%s, expected %s@%s", name, actualUser, actualRealm, username, realm)
+		}
+		return nil
+	}
+}
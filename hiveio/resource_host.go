@@ -2,22 +2,32 @@ package hiveio
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
 func resourceHost() *schema.Resource {
 	return &schema.Resource{
+		Description:   "Join a host to the cluster. Removing the host puts it in maintenance, waits for its guests to migrate to other hosts and unjoins it from the cluster.",
 		CreateContext: resourceHostCreate,
 		ReadContext:   resourceHostRead,
 		UpdateContext: resourceHostUpdate,
 		DeleteContext: resourceHostDelete,
+		CustomizeDiff: resourceHostCustomizeDiff,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceHostImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(30 * time.Minute),
+			Update: schema.DefaultTimeout(30 * time.Minute),
+			Delete: schema.DefaultTimeout(30 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -48,6 +58,13 @@ func resourceHost() *schema.Resource {
 				Default:  false,
 				Optional: true,
 			},
+			"state": {
+				Description:  "The state of the host, `available`, `maintenance` or `broker` for a `gateway_only` host. Defaults to `broker` for gateway hosts and `available` for other hosts, removing the argument leaves the host in its current state.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice(hostStates, false),
+			},
 			"hostid": {
 				Type:     schema.TypeString,
 				Computed: true,
@@ -57,99 +74,282 @@ func resourceHost() *schema.Resource {
 				Description: "unused field to add a license as a dependency",
 				Optional:    true,
 			},
+			"force_remove": {
+				Description: "Remove the host even when shared storage is left with fewer hosts than its minimum set size.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
 		},
 	}
 }
 
 func resourceHostCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	ip := d.Get("ip_address").(string)
-	task, err := client.JoinHost(d.Get("username").(string), d.Get("password").(string), ip)
+	var task *rest.Task
+	err := client.callOnce(ctx, "POST cluster/joinHost", func(c *rest.Client) (err error) {
+		task, err = c.JoinHost(d.Get("username").(string), d.Get("password").(string), ip)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	task, err = task.WaitForTask(client, false)
+	task, err = waitForTask(ctx, client, task, d.Timeout(schema.TimeoutCreate))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	hostid := task.Ref.Host
-	if task.State == "failed" {
-		return diag.Errorf("Failed to Add Host: %s", task.Message)
+	var host rest.Host
+	err = client.call(ctx, "GET host/"+hostid, func(c *rest.Client) (err error) {
+		host, err = c.GetHost(hostid)
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	d.SetId(host.Hostid)
+	err = setHostRole(ctx, client, &host, d.Get("gateway_only").(bool))
+	if err != nil {
+		return diagFromErr(err)
 	}
-	host, err := client.GetHost(hostid)
+	err = setHostState(ctx, client, &host, hostTargetState(d), d.Timeout(schema.TimeoutCreate))
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	return resourceHostRead(ctx, d, m)
+}
+
+// hostTargetState returns the configured state of a host or the default for
+// its role.
+func hostTargetState(d *schema.ResourceData) string {
+	if state := d.Get("state").(string); state != "" {
+		return state
 	}
-	state := "available"
 	if d.Get("gateway_only").(bool) {
-		state = "broker"
+		return "broker"
 	}
-	task, err = host.SetState(client, state)
-	if err != nil {
-		return diag.FromErr(err)
+	return "available"
+}
+
+// hostRoleGateway is the appliance role of a gateway_only host.
+const hostRoleGateway = "gateway"
+
+// setHostRole makes the host a gateway or clears its role. The role is part
+// of the appliance settings, changing the state of a host does not change it.
+func setHostRole(ctx context.Context, client *hiveClient, host *rest.Host, gateway bool) error {
+	if (host.Appliance.Role == hostRoleGateway) == gateway {
+		return nil
 	}
-	task, err = task.WaitForTask(client, false)
-	if err != nil {
-		return diag.FromErr(err)
+	role := ""
+	if gateway {
+		role = hostRoleGateway
 	}
-	if task.State == "failed" {
-		return diag.Errorf("Failed to set host state: %s", task.Message)
+	log.Printf("[INFO] Changing the role of host %s from %q to %q", host.Hostname, host.Appliance.Role, role)
+	host.Appliance.Role = role
+	return client.call(ctx, "PUT host/"+host.Hostid, func(c *rest.Client) error {
+		_, err := host.UpdateAppliance(c)
+		return err
+	})
+}
+
+// setHostState changes the state of a host and waits for the task.
+func setHostState(ctx context.Context, client *hiveClient, host *rest.Host, state string, timeout time.Duration) error {
+	log.Printf("[INFO] Changing the state of host %s from %s to %s", host.Hostname, host.State, state)
+	var task *rest.Task
+	err := client.callOnce(ctx, "POST host/"+host.Hostid+"/state?state="+state, func(c *rest.Client) (err error) {
+		task, err = host.SetState(c, state)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	d.SetId(host.Hostid)
-	return resourceHostRead(ctx, d, m)
+	_, err = waitForTask(ctx, client, task, timeout)
+	return err
 }
 
 func resourceHostRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var host rest.Host
-	var err error
-	host, err = client.GetHost(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err := client.call(ctx, "GET host/"+d.Id(), func(c *rest.Client) (err error) {
+		host, err = c.GetHost(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	d.Set("gateway_only", host.Appliance.Role == "gateway")
+	d.Set("gateway_only", host.Appliance.Role == hostRoleGateway)
+	d.Set("state", host.State)
 	d.Set("hostname", host.Hostname)
 	d.Set("hostid", d.Id())
 	return diag.Diagnostics{}
 }
 
 func resourceHostUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	_, err := client.GetHost(d.Id())
+	client := m.(*hiveClient)
+	var host rest.Host
+	err := client.call(ctx, "GET host/"+d.Id(), func(c *rest.Client) (err error) {
+		host, err = c.GetHost(d.Id())
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	//Don't change anything for now
-	return diag.Diagnostics{}
+	if d.HasChange("gateway_only") {
+		err = setHostRole(ctx, client, &host, d.Get("gateway_only").(bool))
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+	if state := hostTargetState(d); d.HasChanges("state", "gateway_only") && state != host.State {
+		err = setHostState(ctx, client, &host, state, d.Timeout(schema.TimeoutUpdate))
+		if err != nil {
+			return diagFromErr(err)
+		}
+	}
+	return resourceHostRead(ctx, d, m)
+}
+
+// resourceHostCustomizeDiff plans the default state of the new role when
+// gateway_only changes without a state and rejects states that do not match
+// the role.
+func resourceHostCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() != "" && d.HasChange("gateway_only") && !d.HasChange("state") {
+		return d.SetNewComputed("state")
+	}
+	if !d.NewValueKnown("state") || !d.NewValueKnown("gateway_only") {
+		return nil
+	}
+	state, gateway := d.Get("state").(string), d.Get("gateway_only").(bool)
+	if state == "broker" && !gateway {
+		return fmt.Errorf("state broker requires gateway_only")
+	}
+	if state == "available" && gateway {
+		return fmt.Errorf("a gateway_only host is broker instead of available")
+	}
+	return nil
+}
+
+func resourceHostImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	d.Set("force_remove", false)
+	return []*schema.ResourceData{d}, nil
 }
 
 func resourceHostDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	host, err := client.GetHost(d.Id())
+	client := m.(*hiveClient)
+	deadline := time.Now().Add(d.Timeout(schema.TimeoutDelete))
+	var host rest.Host
+	err := client.call(ctx, "GET host/"+d.Id(), func(c *rest.Client) (err error) {
+		host, err = c.GetHost(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	if diags := checkSharedStorageMembers(ctx, client, &host, d.Get("force_remove").(bool)); diags.HasError() {
+		return diags
 	}
 	if host.State != "maintenance" {
-		task, err := host.SetState(client, "maintenance")
+		err = setHostState(ctx, client, &host, "maintenance", time.Until(deadline))
 		if err != nil {
-			return diag.FromErr(err)
+			return diagFromErr(err)
+		}
+	}
+	err = drainHost(ctx, client, &host, time.Until(deadline))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	//services might still be restarting from maintenance mode
+	err = resource.RetryContext(ctx, time.Until(deadline), func() *resource.RetryError {
+		var state string
+		err := client.call(ctx, "GET host/"+host.Hostid+"/state", func(c *rest.Client) (err error) {
+			state, err = host.GetState(c)
+			return err
+		})
+		if err != nil && (isRetryable(err) || isLocked(err)) {
+			return resource.RetryableError(fmt.Errorf("host %s is not responding: %w", host.Hostname, err))
 		}
-		task, err = task.WaitForTask(client, false)
 		if err != nil {
-			return diag.FromErr(err)
+			return resource.NonRetryableError(err)
 		}
-		if task.State == "failed" {
-			return diag.Errorf("Failed to enter maintenance mode: %s", task.Message)
+		if state != "maintenance" {
+			return resource.RetryableError(fmt.Errorf("host %s is %s", host.Hostname, state))
 		}
-	}
-	//services might still be restarting from maintenance mode
-	time.Sleep(10 * time.Second)
-	err = host.UnjoinCluster(client)
+		err = client.callOnce(ctx, "POST host/"+host.Hostid+"/cluster/unjoin", func(c *rest.Client) error {
+			return host.UnjoinCluster(c)
+		})
+		if err != nil && (isRetryable(err) || isLocked(err)) {
+			return resource.RetryableError(fmt.Errorf("host %s is not ready to leave the cluster: %w", host.Hostname, err))
+		}
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+		return nil
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
+
+// checkSharedStorageMembers refuses to remove a host that would leave shared
+// storage with fewer members than its minimum set size, unless force is set.
+func checkSharedStorageMembers(ctx context.Context, client *hiveClient, host *rest.Host, force bool) diag.Diagnostics {
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster/"+host.Appliance.ClusterID, func(c *rest.Client) (err error) {
+		cluster, err = c.GetCluster(host.Appliance.ClusterID)
+		return err
+	})
+	if err != nil {
+		return diagFromErr(err)
+	}
+	shared := cluster.SharedStorage
+	if shared == nil || !shared.Enabled {
+		return nil
+	}
+	member := false
+	for _, h := range shared.Hosts {
+		if h.Hostid == host.Hostid {
+			member = true
+		}
+	}
+	remaining := len(shared.Hosts) - 1
+	if !member || remaining >= shared.MinSetSize {
+		return nil
+	}
+	if force {
+		log.Printf("[WARN] Removing host %s leaves shared storage with %d hosts, its minimum set size is %d", host.Hostname, remaining, shared.MinSetSize)
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("Host %s is needed by shared storage", host.Hostname),
+		Detail:   fmt.Sprintf("Removing the host would leave shared storage with %d hosts, its minimum set size is %d. Add another host or disable shared storage first, or set force_remove to remove the host anyway.", remaining, shared.MinSetSize),
+	}}
+}
+
+// drainHost waits for the guests of a host in maintenance to migrate to
+// other hosts.
+func drainHost(ctx context.Context, client *hiveClient, host *rest.Host, timeout time.Duration) error {
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var guests []rest.Guest
+		err := client.call(ctx, "GET guests?hostid="+host.Hostid, func(c *rest.Client) (err error) {
+			guests, err = c.ListGuests("hostid=" + host.Hostid)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+		if len(guests) > 0 {
+			log.Printf("[INFO] Waiting for %d guests to migrate from host %s", len(guests), host.Hostname)
+			return resource.RetryableError(fmt.Errorf("%d guests are still running on host %s", len(guests), host.Hostname))
+		}
+		return nil
+	})
+}
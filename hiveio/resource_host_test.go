@@ -0,0 +1,200 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestResourceHost(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_host",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"ip_address": "10.0.0.11",
+					"password":   "admin",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_host.test", "hostid"),
+					resource.TestCheckResourceAttr("hiveio_host.test", "hostname", "hive1"),
+					resource.TestCheckResourceAttr("hiveio_host.test", "gateway_only", "false"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address": "10.0.0.11",
+					"password":   "admin",
+					"license":    "AAAA-BBBB-CCCC",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_host.test", "license", "AAAA-BBBB-CCCC"),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address": "10.0.0.11",
+					"password":   "admin",
+					"state":      "broker",
+				},
+				ExpectError: regexp.MustCompile("state broker requires gateway_only"),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address": "10.0.0.11",
+					"password":   "admin",
+					"state":      "maintenance",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_host.test", "state", "maintenance"),
+					testCheckHostState(fake, "maintenance", ""),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address":   "10.0.0.11",
+					"password":     "admin",
+					"gateway_only": true,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_host.test", "state", "broker"),
+					resource.TestCheckResourceAttr("hiveio_host.test", "gateway_only", "true"),
+					testCheckHostState(fake, "broker", "gateway"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address":   "10.0.0.11",
+					"password":     "admin",
+					"gateway_only": false,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_host.test", "state", "available"),
+					testCheckHostState(fake, "available", ""),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"ip_address", "username", "password", "license"},
+	})
+}
+
+func TestResourceHostGateway(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_host",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"ip_address": "10.0.0.12",
+					"password":   "",
+				},
+				ExpectError: regexp.MustCompile("remotePassword is required"),
+			},
+			{
+				Config: map[string]interface{}{
+					"ip_address":   "10.0.0.12",
+					"password":     "admin",
+					"gateway_only": true,
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_host.test", "gateway_only", "true"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"ip_address", "username", "password", "license"},
+	})
+}
+
+func TestResourceHostDrain(t *testing.T) {
+	fake := newFakeHive(t)
+	other := fake.addHost("10.0.0.11")
+	config := map[string]interface{}{
+		"ip_address": "10.0.0.12",
+		"password":   "admin",
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_host",
+		Steps: []lifecycleStep{
+			{
+				Config: config,
+			},
+			{
+				PreConfig: func() {
+					fake.update(func() {
+						for _, host := range fake.hosts {
+							if host.IP == "10.0.0.12" {
+								fake.guests["DRAIN1"] = &rest.Guest{Name: "DRAIN1", Hostid: host.Hostid, GuestState: "ready"}
+							}
+						}
+					})
+				},
+				Config: config,
+			},
+		},
+		ImportStateVerifyIgnore: []string{"ip_address", "username", "password", "license"},
+		CheckDestroy: func(*terraform.State) error {
+			if guest := fake.guest("DRAIN1"); guest.Hostid != other.Hostid {
+				return fmt.Errorf("guest DRAIN1 was not migrated to %s", other.Hostname)
+			}
+			return nil
+		},
+	})
+}
+
+func TestResourceHostSharedStorageMinimum(t *testing.T) {
+	fake := newFakeHive(t)
+	var host *rest.Host
+	for _, ip := range []string{"10.0.0.11", "10.0.0.12", "10.0.0.13"} {
+		host = fake.addHost(ip)
+	}
+	client := testClient(t, fake)
+	cluster := fake.cluster
+	var task *rest.Task
+	err := client.callOnce(context.Background(), "POST cluster/"+cluster.ID+"/enableSharedStorage", func(c *rest.Client) (err error) {
+		task, err = cluster.EnableSharedStorage(c, 50, 3)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitForTask(context.Background(), client, task, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resourceHost()
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"ip_address": host.IP, "password": "admin"})
+	d.SetId(host.Hostid)
+	err = diagsError(resourceHostDelete(context.Background(), d, client))
+	if err == nil || !regexp.MustCompile("Host hive3 is needed by shared storage").MatchString(err.Error()) {
+		t.Fatalf("expected shared storage error, got %v", err)
+	}
+	if fake.host(host.Hostid) == nil {
+		t.Fatal("host was removed")
+	}
+
+	d.Set("force_remove", true)
+	if err := diagsError(resourceHostDelete(context.Background(), d, client)); err != nil {
+		t.Fatal(err)
+	}
+	if fake.host(host.Hostid) != nil {
+		t.Fatal("host was not removed")
+	}
+}
+
+// testCheckHostState checks the state and role of the host in the fake.
+func testCheckHostState(fake *fakeHive, state, role string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		host := fake.host(s.RootModule().Resources["hiveio_host.test"].Primary.ID)
+		if host == nil {
+			return fmt.Errorf("host does not exist")
+		}
+		if host.State != state || host.Appliance.Role != role {
+			return fmt.Errorf("host is %s with role %q, expected %s with role %q", host.State, host.Appliance.Role, state, role)
+		}
+		return nil
+	}
+}
@@ -2,6 +2,7 @@ package hiveio
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -17,6 +18,10 @@ func resourceLicense() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"license": {
@@ -41,39 +46,45 @@ func resourceLicense() *schema.Resource {
 }
 
 func resourceLicenseCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	clusterID, err := client.ClusterID()
-	if err != nil {
-		return diag.FromErr(err)
-	}
-	cluster, err := client.GetCluster(clusterID)
+	client := m.(*hiveClient)
+	err := client.call(ctx, "PUT cluster/license", func(c *rest.Client) error {
+		clusterID, err := c.ClusterID()
+		if err != nil {
+			return err
+		}
+		cluster, err := c.GetCluster(clusterID)
+		if err != nil {
+			return err
+		}
+		return cluster.SetLicense(c, d.Get("license").(string))
+	})
 	if err != nil {
-		return diag.FromErr(err)
-	}
-	err = cluster.SetLicense(client, d.Get("license").(string))
-	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(d.Get("license").(string))
 	return resourceLicenseRead(ctx, d, m)
 }
 
 func resourceLicenseRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	clusterID, err := client.ClusterID()
-	if err != nil {
-		return diag.FromErr(err)
-	}
-	cluster, err := client.GetCluster(clusterID)
+	client := m.(*hiveClient)
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster", func(c *rest.Client) error {
+		clusterID, err := c.ClusterID()
+		if err != nil {
+			return err
+		}
+		cluster, err = c.GetCluster(clusterID)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	if cluster.License == nil {
 		d.SetId("")
 		return diag.Diagnostics{}
 	}
 	d.Set("type", cluster.License.Type)
-	d.Set("expiration", cluster.License.Expiration)
+	d.Set("expiration", cluster.License.Expiration.Format(time.RFC3339))
 	d.Set("max_guests", cluster.License.MaxGuests)
 	return diag.Diagnostics{}
 }
@@ -0,0 +1,28 @@
+package hiveio
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestResourceLicense(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_license",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"license": "AAAA-BBBB-CCCC",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_license.test", "type", "enterprise"),
+					resource.TestCheckResourceAttr("hiveio_license.test", "max_guests", "100"),
+					resource.TestCheckResourceAttrSet("hiveio_license.test", "expiration"),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"license"},
+		KeepsRemoteObject:       true,
+	})
+}
@@ -2,10 +2,12 @@ package hiveio
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -15,9 +17,23 @@ func resourceProfile() *schema.Resource {
 		ReadContext:   resourceProfileRead,
 		UpdateContext: resourceProfileUpdate,
 		DeleteContext: resourceProfileDelete,
+		CustomizeDiff: resourceProfileCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceProfileV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceProfileStateUpgradeV0,
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -48,11 +64,17 @@ func resourceProfile() *schema.Resource {
 							Optional:    true,
 						},
 						"password": {
-							Description: "Password for the service account.",
+							Description: "Password for the service account. The api does not return the password, a new password is only sent when `password_version` changes.",
 							Type:        schema.TypeString,
 							Optional:    true,
 							Sensitive:   true,
 						},
+						"password_version": {
+							Description: "Change this value together with `password` to rotate the service account password.",
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     0,
+						},
 						"user_group": {
 							Description: "AD group for users who can login through the broker.",
 							Type:        schema.TypeString,
@@ -94,109 +116,53 @@ func resourceProfile() *schema.Resource {
 				},
 			},
 			"broker_options": {
-				Type:     schema.TypeList,
-				Optional: true,
-				MaxItems: 1,
+				Description: "Options for connections through the broker.",
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
-						"allow_desktop_composition": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"audio_capture": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"credssp": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"disable_full_window_drag": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"disable_menu_anims": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"disable_printer": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"disable_themes": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"disable_wallpaper": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"fail_on_cert_mismatch": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"hide_authentication_failure": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
+						"rdp": {
+							Description: "RDP connection options, the defaults are used when the block is left out.",
+							Type:        schema.TypeList,
+							Optional:    true,
+							Computed:    true,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: profileRDPSchema(),
+							},
 						},
 						"html5": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"inject_password": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"redirect_clipboard": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"redirect_disk": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"redirect_pnp": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"redirect_printer": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"redirect_smartcard": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"redirect_usb": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"smart_resize": {
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
+							Description: "HTML5 connection options.",
+							Type:        schema.TypeList,
+							Optional:    true,
+							Computed:    true,
+							MaxItems:    1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"enabled": {
+										Description: "Allow connections from the HTML5 client.",
+										Type:        schema.TypeBool,
+										Optional:    true,
+										Default:     true,
+									},
+								},
+							},
 						},
 					},
 				},
 			},
+			"bypass_broker": {
+				Description: "Connect users directly to their guests instead of through the broker.",
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+			},
+			"vlan": {
+				Description: "VLAN for guests using this profile.",
+				Type:        schema.TypeInt,
+				Optional:    true,
+			},
 			"backup": {
 				Type:     schema.TypeList,
 				Optional: true,
@@ -208,8 +174,9 @@ func resourceProfile() *schema.Resource {
 							Required: true,
 						},
 						"frequency": {
-							Type:     schema.TypeString,
-							Required: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringInSlice(backupFrequency, false),
 						},
 						"target": {
 							Type:     schema.TypeString,
@@ -224,8 +191,10 @@ func resourceProfile() *schema.Resource {
 
 func profileFromResource(d *schema.ResourceData) *rest.Profile {
 	profile := &rest.Profile{
-		Name:     d.Get("name").(string),
-		Timezone: d.Get("timezone").(string),
+		Name:         d.Get("name").(string),
+		Timezone:     d.Get("timezone").(string),
+		BypassBroker: d.Get("bypass_broker").(bool),
+		Vlan:         d.Get("vlan").(int),
 	}
 
 	if d.Id() != "" {
@@ -235,41 +204,28 @@ func profileFromResource(d *schema.ResourceData) *rest.Profile {
 		var adConfig rest.ProfileADConfig
 		adConfig.Domain = d.Get("ad_config.0.domain").(string)
 		adConfig.Username = d.Get("ad_config.0.username").(string)
-		adConfig.Password = d.Get("ad_config.0.password").(string)
 		adConfig.UserGroup = d.Get("ad_config.0.user_group").(string)
-		if ou, ok := d.GetOk("ad_config.0.ou"); ok {
-			adConfig.Ou = ou.(string)
-		}
-		if username, ok := d.GetOk("ad_config.0.username"); ok {
-			adConfig.Username = username.(string)
-		}
-		if password, ok := d.GetOk("ad_config.0.password"); ok {
-			adConfig.Password = password.(string)
+		adConfig.Ou = d.Get("ad_config.0.ou").(string)
+		if profilePasswordChanged(d) {
+			adConfig.Password = d.Get("ad_config.0.password").(string)
 		}
 		profile.AdConfig = &adConfig
 	}
 	if _, ok := d.GetOk("broker_options"); ok {
-		var config rest.ProfileBrokerOptions
-		config.AllowDesktopComposition = d.Get("broker_options.0.allow_desktop_composition").(bool)
-		config.AudioCapture = d.Get("broker_options.0.audio_capture").(bool)
-		config.RedirectCSSP = d.Get("broker_options.0.credssp").(bool)
-		config.FailOnCertMismatch = d.Get("broker_options.0.fail_on_cert_mismatch").(bool)
-		config.HideAuthenticationFailure = d.Get("broker_options.0.hide_authentication_failure").(bool)
-		config.RedirectClipboard = d.Get("broker_options.0.redirect_clipboard").(bool)
-		config.RedirectDisk = d.Get("broker_options.0.redirect_disk").(bool)
-		config.RedirectPNP = d.Get("broker_options.0.redirect_pnp").(bool)
-		config.RedirectPrinter = d.Get("broker_options.0.redirect_printer").(bool)
-		config.RedirectSmartCard = d.Get("broker_options.0.redirect_smartcard").(bool)
-		config.RedirectUSB = d.Get("broker_options.0.redirect_usb").(bool)
-		config.SmartResize = d.Get("broker_options.0.smart_resize").(bool)
-		config.EnableHTML5 = d.Get("broker_options.0.html5").(bool)
-		config.DisableFullWindowDrag = d.Get("broker_options.0.disable_full_window_drag").(bool)
-		config.DisableMenuAnims = d.Get("broker_options.0.disable_menu_anims").(bool)
-		config.DisablePrinter = d.Get("broker_options.0.disable_printer").(bool)
-		config.DisableThemes = d.Get("broker_options.0.disable_themes").(bool)
-		config.DisableWallpaper = d.Get("broker_options.0.disable_wallpaper").(bool)
-		config.InjectPassword = d.Get("broker_options.0.inject_password").(bool)
-		profile.BrokerOptions = &config
+		// rdp and html5 are computed, they are empty until they are set in
+		// the configuration or read from the api.
+		options := &rest.ProfileBrokerOptions{EnableHTML5: true}
+		_, rdp := d.GetOk("broker_options.0.rdp")
+		for _, option := range profileRDPOptions {
+			*option.field(options) = option.enabled
+			if rdp {
+				*option.field(options) = d.Get("broker_options.0.rdp.0." + option.name).(bool)
+			}
+		}
+		if _, ok := d.GetOk("broker_options.0.html5"); ok {
+			options.EnableHTML5 = d.Get("broker_options.0.html5.0.enabled").(bool)
+		}
+		profile.BrokerOptions = options
 	}
 
 	if _, ok := d.GetOk("user_volumes"); ok {
@@ -295,99 +251,214 @@ func profileFromResource(d *schema.ResourceData) *rest.Profile {
 	return profile
 }
 
+// profilePasswordChanged reports whether the ad_config password has to be
+// sent. The api keeps the stored password when it is left out, it is sent for
+// new profiles, a new password_version or when the previous password is not
+// known, for example after an import.
+func profilePasswordChanged(d *schema.ResourceData) bool {
+	old, _ := d.GetChange("ad_config.0.password")
+	return d.Id() == "" || d.HasChange("ad_config.0.password_version") || old.(string) == ""
+}
+
+// resourceProfileCustomizeDiff rejects a changed ad_config password without a
+// new password_version, the api does not return the password to compare.
+func resourceProfileCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || !d.HasChange("ad_config.0.password") || d.HasChange("ad_config.0.password_version") {
+		return nil
+	}
+	if old, _ := d.GetChange("ad_config.0.password"); old.(string) == "" {
+		return nil
+	}
+	return fmt.Errorf("ad_config password changed without a new password_version")
+}
+
 func resourceProfileCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	profile := profileFromResource(d)
-	_, err := profile.Create(client)
+	err := client.callOnce(ctx, "POST profiles", func(c *rest.Client) error {
+		_, err := profile.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	profile, err = client.GetProfileByName(profile.Name)
+	err = client.call(ctx, "GET profiles?name="+profile.Name, func(c *rest.Client) (err error) {
+		profile, err = c.GetProfileByName(profile.Name)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(profile.ID)
 	return resourceProfileRead(ctx, d, m)
 }
 
 func resourceProfileRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var profile *rest.Profile
-	var err error
-	profile, err = client.GetProfile(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err := client.call(ctx, "GET profile/"+d.Id(), func(c *rest.Client) (err error) {
+		profile, err = c.GetProfile(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	d.Set("name", profile.Name)
 	d.Set("timezone", profile.Timezone)
+	d.Set("bypass_broker", profile.BypassBroker)
+	d.Set("vlan", profile.Vlan)
+
+	adConfig := flattenProfileADConfig(profile.AdConfig)
+	if len(adConfig) > 0 {
+		config := adConfig[0].(map[string]interface{})
+		config["password"] = d.Get("ad_config.0.password")
+		config["password_version"] = d.Get("ad_config.0.password_version")
+	}
+	d.Set("ad_config", adConfig)
+	d.Set("user_volumes", flattenProfileUserVolumes(profile.UserVolumes))
+	d.Set("backup", flattenProfileBackup(profile.Backup))
+	d.Set("broker_options", flattenProfileBrokerOptions(profile.BrokerOptions))
+	return diag.Diagnostics{}
+}
 
-	if profile.AdConfig != nil {
-		d.Set("ad_config.0.domain", profile.AdConfig.Domain)
-		d.Set("ad_config.0.username", profile.AdConfig.Domain)
-		d.Set("ad_config.0.user_group", profile.AdConfig.UserGroup)
-		d.Set("ad_config.0.ou", profile.AdConfig.Ou)
+// flattenProfileADConfig returns ad_config without the password, the api
+// does not return it.
+func flattenProfileADConfig(config *rest.ProfileADConfig) []interface{} {
+	if config == nil {
+		return nil
 	}
+	return []interface{}{
+		map[string]interface{}{
+			"domain":     config.Domain,
+			"username":   config.Username,
+			"user_group": config.UserGroup,
+			"ou":         config.Ou,
+		},
+	}
+}
 
-	if profile.UserVolumes != nil {
-		d.Set("user_volumes.0.repository", profile.UserVolumes.Repository)
-		d.Set("user_volumes.0.size", profile.UserVolumes.Size)
-		d.Set("user_volumes.0.backup_schedule", profile.UserVolumes.BackupSchedule)
-		d.Set("user_volumes.0.target", profile.UserVolumes.Target)
+func flattenProfileUserVolumes(uv *rest.ProfileUserVolumes) []interface{} {
+	if uv == nil {
+		return nil
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"repository":      uv.Repository,
+			"size":            uv.Size,
+			"backup_schedule": uv.BackupSchedule,
+			"target":          uv.Target,
+		},
 	}
+}
 
-	if profile.Backup != nil {
-		d.Set("backup.0.enabled", profile.Backup.Enabled)
-		d.Set("backup.0.frequency", profile.Backup.Frequency)
-		d.Set("backup.0.target", profile.Backup.TargetStorageID)
+func flattenProfileBackup(backup *rest.ProfileBackup) []interface{} {
+	if backup == nil {
+		return nil
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"enabled":   backup.Enabled,
+			"frequency": backup.Frequency,
+			"target":    backup.TargetStorageID,
+		},
 	}
+}
 
-	if profile.BrokerOptions != nil {
-		d.Set("broker_options.0.allow_desktop_composition", profile.BrokerOptions.AllowDesktopComposition)
-		d.Set("broker_options.0.audio_capture", profile.BrokerOptions.AudioCapture)
-		d.Set("broker_options.0.credssp", profile.BrokerOptions.RedirectCSSP)
-		d.Set("broker_options.0.disable_full_window_drag", profile.BrokerOptions.DisableFullWindowDrag)
-		d.Set("broker_options.0.disable_menu_anims", profile.BrokerOptions.DisableMenuAnims)
-		d.Set("broker_options.0.disable_printer", profile.BrokerOptions.DisablePrinter)
-		d.Set("broker_options.0.disable_themes", profile.BrokerOptions.DisableThemes)
-		d.Set("broker_options.0.disable_wallpaper", profile.BrokerOptions.DisableWallpaper)
-		d.Set("broker_options.0.fail_on_cert_mismatch", profile.BrokerOptions.FailOnCertMismatch)
-		d.Set("broker_options.0.hide_authentication_failure", profile.BrokerOptions.HideAuthenticationFailure)
-		d.Set("broker_options.0.html5", profile.BrokerOptions.EnableHTML5)
-		d.Set("broker_options.0.inject_password", profile.BrokerOptions.InjectPassword)
-		d.Set("broker_options.0.redirect_clipboard", profile.BrokerOptions.RedirectClipboard)
-		d.Set("broker_options.0.redirect_disk", profile.BrokerOptions.RedirectDisk)
-		d.Set("broker_options.0.redirect_pnp", profile.BrokerOptions.RedirectPNP)
-		d.Set("broker_options.0.redirect_printer", profile.BrokerOptions.RedirectPrinter)
-		d.Set("broker_options.0.redirect_smartcard", profile.BrokerOptions.RedirectSmartCard)
-		d.Set("broker_options.0.redirect_usb", profile.BrokerOptions.RedirectUSB)
-		d.Set("broker_options.0.smart_resize", profile.BrokerOptions.SmartResize)
+func flattenProfileBrokerOptions(options *rest.ProfileBrokerOptions) []interface{} {
+	if options == nil {
+		return nil
+	}
+	rdp := map[string]interface{}{}
+	for _, option := range profileRDPOptions {
+		rdp[option.name] = *option.field(options)
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"rdp": []interface{}{rdp},
+			"html5": []interface{}{
+				map[string]interface{}{"enabled": options.EnableHTML5},
+			},
+		},
 	}
-	return diag.Diagnostics{}
 }
 
 func resourceProfileUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	profile := profileFromResource(d)
-	_, err := profile.Update(client)
+	err := client.call(ctx, "PUT profile/"+d.Id(), func(c *rest.Client) error {
+		_, err := profile.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return resourceProfileRead(ctx, d, m)
 }
 
 func resourceProfileDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	profile, err := client.GetProfile(d.Id())
+	client := m.(*hiveClient)
+	var profile *rest.Profile
+	err := client.call(ctx, "GET profile/"+d.Id(), func(c *rest.Client) (err error) {
+		profile, err = c.GetProfile(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = profile.Delete(client)
+	err = client.call(ctx, "DELETE profile/"+d.Id(), func(c *rest.Client) error {
+		return profile.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
+
+// profileRDPOption is an RDP flag of the profile broker options.
+type profileRDPOption struct {
+	name    string
+	enabled bool
+	field   func(*rest.ProfileBrokerOptions) *bool
+}
+
+// profileRDPOptions are the arguments of broker_options.rdp with their
+// defaults.
+var profileRDPOptions = []profileRDPOption{
+	{"allow_desktop_composition", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.AllowDesktopComposition }},
+	{"audio_capture", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.AudioCapture }},
+	{"credssp", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectCSSP }},
+	{"disable_full_window_drag", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.DisableFullWindowDrag }},
+	{"disable_menu_anims", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.DisableMenuAnims }},
+	{"disable_printer", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.DisablePrinter }},
+	{"disable_themes", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.DisableThemes }},
+	{"disable_wallpaper", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.DisableWallpaper }},
+	{"fail_on_cert_mismatch", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.FailOnCertMismatch }},
+	{"hide_authentication_failure", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.HideAuthenticationFailure }},
+	{"inject_password", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.InjectPassword }},
+	{"redirect_clipboard", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectClipboard }},
+	{"redirect_disk", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectDisk }},
+	{"redirect_pnp", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectPNP }},
+	{"redirect_printer", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectPrinter }},
+	{"redirect_smartcard", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectSmartCard }},
+	{"redirect_usb", false, func(o *rest.ProfileBrokerOptions) *bool { return &o.RedirectUSB }},
+	{"smart_resize", true, func(o *rest.ProfileBrokerOptions) *bool { return &o.SmartResize }},
+}
+
+func profileRDPSchema() map[string]*schema.Schema {
+	s := map[string]*schema.Schema{}
+	for _, option := range profileRDPOptions {
+		s[option.name] = &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  option.enabled,
+		}
+	}
+	return s
+}
@@ -0,0 +1,238 @@
+package hiveio
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceProfileV0 is the profile schema before the rdp flags and html5 moved
+// into nested blocks of broker_options, as it was released. It must not
+// change. Attributes that were added later without a new schema version,
+// like ad_config.password_version, are kept by the upgrade as they are.
+func resourceProfileV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"timezone": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "disabled",
+			},
+			"ad_config": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"domain": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"username": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"password": {
+							Type:      schema.TypeString,
+							Optional:  true,
+							Sensitive: true,
+						},
+						"user_group": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"ou": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"user_volumes": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"backup_schedule": {
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+						"repository": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"size": {
+							Type:      schema.TypeInt,
+							Required:  true,
+							Sensitive: true,
+						},
+						"target": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"broker_options": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"allow_desktop_composition": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"audio_capture": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"credssp": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"disable_full_window_drag": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"disable_menu_anims": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"disable_printer": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"disable_themes": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"disable_wallpaper": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"fail_on_cert_mismatch": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"hide_authentication_failure": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"html5": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"inject_password": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"redirect_clipboard": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"redirect_disk": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"redirect_pnp": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"redirect_printer": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"redirect_smartcard": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"redirect_usb": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  false,
+						},
+						"smart_resize": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+					},
+				},
+			},
+			"backup": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"enabled": {
+							Type:     schema.TypeBool,
+							Required: true,
+						},
+						"frequency": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"target": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// resourceProfileStateUpgradeV0 moves the flat broker options into the rdp
+// and html5 blocks.
+func resourceProfileStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	options, ok := rawState["broker_options"].([]interface{})
+	if !ok || len(options) == 0 {
+		return rawState, nil
+	}
+	old, ok := options[0].(map[string]interface{})
+	if !ok {
+		return rawState, nil
+	}
+	rdp := map[string]interface{}{}
+	for _, option := range profileRDPOptions {
+		if value, ok := old[option.name]; ok {
+			rdp[option.name] = value
+		}
+	}
+	html5 := map[string]interface{}{}
+	if value, ok := old["html5"]; ok {
+		html5["enabled"] = value
+	}
+	rawState["broker_options"] = []interface{}{
+		map[string]interface{}{
+			"rdp":   []interface{}{rdp},
+			"html5": []interface{}{html5},
+		},
+	}
+	return rawState, nil
+}
@@ -0,0 +1,233 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestResourceProfile(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_profile",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name": "test",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_profile.test", "id"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "timezone", "disabled"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":     "test",
+					"timezone": "America/Chicago",
+					"user_volumes": []interface{}{
+						map[string]interface{}{
+							"repository": "user-volumes",
+							"size":       10,
+						},
+					},
+					"backup": []interface{}{
+						map[string]interface{}{
+							"enabled":   true,
+							"frequency": "daily",
+							"target":    "backup-pool",
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_profile.test", "timezone", "America/Chicago"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "user_volumes.0.size", "10"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "backup.0.frequency", "daily"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceProfileADConfig(t *testing.T) {
+	fake := newFakeHive(t)
+	config := func(username, password string, version int) map[string]interface{} {
+		return map[string]interface{}{
+			"name": "test",
+			"ad_config": []interface{}{
+				map[string]interface{}{
+					"domain":           "TEST",
+					"username":         username,
+					"password":         password,
+					"password_version": version,
+					"user_group":       "hive-users",
+					"ou":               "OU=Guests,DC=test,DC=example,DC=com",
+				},
+			},
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_profile",
+		Steps: []lifecycleStep{
+			{
+				Config: config("svc_join", "secret", 1),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_profile.test", "ad_config.0.domain", "TEST"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "ad_config.0.username", "svc_join"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "ad_config.0.user_group", "hive-users"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "ad_config.0.ou", "OU=Guests,DC=test,DC=example,DC=com"),
+					testCheckProfileADConfig(fake, rest.ProfileADConfig{
+						Domain:    "TEST",
+						Username:  "svc_join",
+						Password:  "secret",
+						UserGroup: "hive-users",
+						Ou:        "OU=Guests,DC=test,DC=example,DC=com",
+					}),
+				),
+			},
+			{
+				Config:      config("svc_join", "rotated", 1),
+				ExpectError: regexp.MustCompile("ad_config password changed without a new password_version"),
+			},
+			{
+				Config: config("svc_join2", "secret", 1),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_profile.test", "ad_config.0.username", "svc_join2"),
+					testCheckProfileADConfig(fake, rest.ProfileADConfig{
+						Domain:    "TEST",
+						Username:  "svc_join2",
+						Password:  "secret",
+						UserGroup: "hive-users",
+						Ou:        "OU=Guests,DC=test,DC=example,DC=com",
+					}),
+				),
+			},
+			{
+				Config: config("svc_join2", "rotated", 2),
+				Check: testCheckProfileADConfig(fake, rest.ProfileADConfig{
+					Domain:    "TEST",
+					Username:  "svc_join2",
+					Password:  "rotated",
+					UserGroup: "hive-users",
+					Ou:        "OU=Guests,DC=test,DC=example,DC=com",
+				}),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"ad_config.0.password"},
+	})
+}
+
+func TestResourceProfileBrokerOptions(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_profile",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":           "test",
+					"broker_options": []interface{}{map[string]interface{}{}},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_profile.test", "broker_options.0.rdp.0.credssp", "true"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "broker_options.0.rdp.0.redirect_usb", "false"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "broker_options.0.html5.0.enabled", "true"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "bypass_broker", "false"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name": "test",
+					"broker_options": []interface{}{
+						map[string]interface{}{
+							"rdp": []interface{}{
+								map[string]interface{}{
+									"redirect_usb":   true,
+									"smart_resize":   false,
+									"disable_themes": true,
+								},
+							},
+							"html5": []interface{}{
+								map[string]interface{}{"enabled": false},
+							},
+						},
+					},
+					"bypass_broker": true,
+					"vlan":          20,
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_profile.test", "broker_options.0.rdp.0.redirect_usb", "true"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "broker_options.0.html5.0.enabled", "false"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "bypass_broker", "true"),
+					resource.TestCheckResourceAttr("hiveio_profile.test", "vlan", "20"),
+					func(s *terraform.State) error {
+						id := s.RootModule().Resources["hiveio_profile.test"].Primary.ID
+						var profile rest.Profile
+						fake.update(func() { profile = *fake.profiles[id] })
+						options := profile.BrokerOptions
+						if options == nil || !options.RedirectUSB || options.SmartResize || !options.DisableThemes || !options.RedirectCSSP || options.EnableHTML5 {
+							return fmt.Errorf("unexpected broker options %+v", options)
+						}
+						if !profile.BypassBroker || profile.Vlan != 20 {
+							return fmt.Errorf("bypass_broker %v vlan %d, expected true 20", profile.BypassBroker, profile.Vlan)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestResourceProfileStateUpgradeV0(t *testing.T) {
+	state := map[string]interface{}{
+		"name": "test",
+		"broker_options": []interface{}{
+			map[string]interface{}{
+				"credssp":      false,
+				"redirect_usb": true,
+				"html5":        false,
+			},
+		},
+	}
+	actual, err := resourceProfileStateUpgradeV0(context.Background(), state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		map[string]interface{}{
+			"rdp": []interface{}{
+				map[string]interface{}{"credssp": false, "redirect_usb": true},
+			},
+			"html5": []interface{}{
+				map[string]interface{}{"enabled": false},
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual["broker_options"], expected) {
+		t.Fatalf("broker_options is %v, expected %v", actual["broker_options"], expected)
+	}
+}
+
+// testCheckProfileADConfig compares the ad_config of the profile in the fake
+// field by field, including the password the api does not return.
+func testCheckProfileADConfig(fake *fakeHive, expected rest.ProfileADConfig) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		id := s.RootModule().Resources["hiveio_profile.test"].Primary.ID
+		var actual rest.ProfileADConfig
+		fake.update(func() {
+			if profile, ok := fake.profiles[id]; ok && profile.AdConfig != nil {
+				actual = *profile.AdConfig
+				actual.Password = fake.profilePasswords[id]
+			}
+		})
+		if actual != expected {
+			return fmt.Errorf("ad_config is %+v, expected %+v", actual, expected)
+		}
+		return nil
+	}
+}
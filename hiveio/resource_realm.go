@@ -2,7 +2,8 @@ package hiveio
 
 import (
 	"context"
-	"strings"
+	"fmt"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -16,7 +17,12 @@ func resourceRealm() *schema.Resource {
 		UpdateContext: resourceRealmUpdate,
 		DeleteContext: resourceRealmDelete,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceRealmImport,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -31,12 +37,15 @@ func resourceRealm() *schema.Resource {
 				Required:    true,
 			},
 			"enabled": {
-				Type:     schema.TypeBool,
-				Optional: true,
+				Description: "Whether users of the realm can log in.",
+				Type:        schema.TypeBool,
+				Default:     true,
+				Optional:    true,
 			},
 			"verified": {
-				Type:     schema.TypeBool,
-				Optional: true,
+				Description: "Whether the service account of the realm was verified against the domain.",
+				Type:        schema.TypeBool,
+				Computed:    true,
 			},
 			"tags": {
 				Type:     schema.TypeList,
@@ -56,67 +65,129 @@ func resourceRealm() *schema.Resource {
 				Optional:    true,
 				Sensitive:   true,
 			},
+			"verify_on_apply": {
+				Description: "Fail the apply when the service account can not bind to the domain.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
 		},
 	}
 }
 
-func resourceRealmCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+func realmFromResource(d *schema.ResourceData) *rest.Realm {
 	realm := &rest.Realm{
-		Name: d.Get("name").(string),
-		FQDN: d.Get("fqdn").(string),
-		ServiceAccount: &rest.RealmServiceAccount{
-			Username: d.Get("username").(string),
+		Name:    d.Get("name").(string),
+		FQDN:    d.Get("fqdn").(string),
+		Enabled: d.Get("enabled").(bool),
+		// hive verifies the service account when a realm is saved as verified
+		Verified: true,
+	}
+	for _, tag := range d.Get("tags").([]interface{}) {
+		realm.Tags = append(realm.Tags, tag.(string))
+	}
+	if username, ok := d.GetOk("username"); ok {
+		realm.ServiceAccount = &rest.RealmServiceAccount{
+			Username: username.(string),
 			Password: d.Get("password").(string),
-		},
+		}
 	}
+	return realm
+}
 
-	_, err := realm.Create(client)
+func resourceRealmCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	client := m.(*hiveClient)
+	realm := realmFromResource(d)
+	err := client.callOnce(ctx, "POST realms", func(c *rest.Client) error {
+		_, err := realm.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(realm.Name)
-	return resourceRealmRead(ctx, d, m)
+	return resourceRealmApplied(ctx, d, m)
 }
 
 func resourceRealmRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var realm rest.Realm
-	var err error
-	realm, err = client.GetRealm(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err := client.call(ctx, "GET realm/"+d.Id(), func(c *rest.Client) (err error) {
+		realm, err = c.GetRealm(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(realm.Name)
 	d.Set("name", realm.Name)
 	d.Set("fqdn", realm.FQDN)
+	d.Set("enabled", realm.Enabled)
+	d.Set("verified", realm.Verified)
+	d.Set("tags", realm.Tags)
+	if realm.ServiceAccount != nil {
+		d.Set("username", realm.ServiceAccount.Username)
+	} else {
+		d.Set("username", "")
+	}
 	return diag.Diagnostics{}
 }
 
 func resourceRealmUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	var realm rest.Realm
-	realm.Name = d.Get("name").(string)
-	realm.FQDN = d.Get("fqdn").(string)
-	_, err := realm.Update(client)
+	client := m.(*hiveClient)
+	realm := realmFromResource(d)
+	err := client.call(ctx, "PUT realm/"+d.Id(), func(c *rest.Client) error {
+		_, err := realm.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
+	}
+	return resourceRealmApplied(ctx, d, m)
+}
+
+// resourceRealmApplied reads a realm after it was saved and fails when
+// verify_on_apply is set and the service account was not verified.
+func resourceRealmApplied(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	diags := resourceRealmRead(ctx, d, m)
+	if diags.HasError() || !d.Get("verify_on_apply").(bool) || d.Get("verified").(bool) {
+		return diags
 	}
-	return resourceRealmRead(ctx, d, m)
+	return append(diags, diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("Realm %s is not verified", d.Id()),
+		Detail:   fmt.Sprintf("The service account %q could not bind to %s.", d.Get("username").(string), d.Get("fqdn").(string)),
+	})
+}
+
+// resourceRealmImport sets the arguments that are not stored in the realm to
+// their defaults.
+func resourceRealmImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	d.Set("verify_on_apply", false)
+	return []*schema.ResourceData{d}, nil
 }
 
 func resourceRealmDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	realm, err := client.GetRealm(d.Id())
+	client := m.(*hiveClient)
+	var realm rest.Realm
+	err := client.call(ctx, "GET realm/"+d.Id(), func(c *rest.Client) (err error) {
+		realm, err = c.GetRealm(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = realm.Delete(client)
+	err = client.call(ctx, "DELETE realm/"+d.Id(), func(c *rest.Client) error {
+		return realm.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
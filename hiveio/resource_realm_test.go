@@ -0,0 +1,90 @@
+package hiveio
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceRealm(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_realm",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":     "TEST",
+					"fqdn":     "test.example.com",
+					"username": "svc_hive",
+					"password": "secret",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_realm.test", "id", "TEST"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "fqdn", "test.example.com"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "enabled", "true"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "verified", "true"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":     "TEST",
+					"fqdn":     "ad.example.com",
+					"enabled":  false,
+					"tags":     []interface{}{"lab"},
+					"username": "svc_hive2",
+					"password": "secret2",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_realm.test", "fqdn", "ad.example.com"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "enabled", "false"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "tags.0", "lab"),
+					resource.TestCheckResourceAttr("hiveio_realm.test", "username", "svc_hive2"),
+					func(*terraform.State) error {
+						var password string
+						fake.update(func() { password = fake.realms["TEST"].ServiceAccount.Password })
+						if password != "secret2" {
+							return fmt.Errorf("service account password was not updated: %q", password)
+						}
+						return nil
+					},
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"password"},
+	})
+}
+
+func TestResourceRealmVerifyOnApply(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.adPassword = "secret"
+	config := func(password string, verify bool) map[string]interface{} {
+		return map[string]interface{}{
+			"name":            "TEST",
+			"fqdn":            "test.example.com",
+			"username":        "svc_hive",
+			"password":        password,
+			"verify_on_apply": verify,
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_realm",
+		Steps: []lifecycleStep{
+			{
+				Config: config("wrong", false),
+				Check:  resource.TestCheckResourceAttr("hiveio_realm.test", "verified", "false"),
+			},
+			{
+				Config:      config("wrong", true),
+				ExpectError: regexp.MustCompile(`Realm TEST is not verified: The service account "svc_hive" could not bind to test.example.com`),
+			},
+			{
+				Config: config("secret", true),
+				Check:  resource.TestCheckResourceAttr("hiveio_realm.test", "verified", "true"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"password", "verify_on_apply"},
+	})
+}
@@ -2,6 +2,7 @@ package hiveio
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -20,6 +21,10 @@ func resourceSharedStorage() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(30 * time.Minute),
+			Delete: schema.DefaultTimeout(30 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"minimum_set_size": {
@@ -55,48 +60,59 @@ func resourceSharedStorage() *schema.Resource {
 				ForceNew: true,
 			},
 		},
-		Timeouts: &schema.ResourceTimeout{
-			Delete: schema.DefaultTimeout(3 * time.Minute),
-		},
 	}
 }
 
 func resourceSharedStorageCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	setSize := d.Get("minimum_set_size").(int)
 	utilization := d.Get("utilization").(int)
-	clusterID, err := client.ClusterID()
-	if err != nil {
-		return diag.FromErr(err)
-	}
-	cluster, err := client.GetCluster(clusterID)
+	var clusterID string
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster", func(c *rest.Client) (err error) {
+		clusterID, err = c.ClusterID()
+		if err != nil {
+			return err
+		}
+		cluster, err = c.GetCluster(clusterID)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
-		task, err := cluster.EnableSharedStorage(client, utilization, setSize)
-		if err != nil && strings.Contains(err.Error(), "Not enough hosts") {
-			//waitForMinimumHosts(client, clusterID, setSize, 30*time.Second)
-			time.Sleep(15 * time.Second)
+	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutCreate), func() *resource.RetryError {
+		var task *rest.Task
+		err := client.callOnce(ctx, "POST cluster/"+cluster.ID+"/enableSharedStorage", func(c *rest.Client) (err error) {
+			task, err = cluster.EnableSharedStorage(c, utilization, setSize)
+			return err
+		})
+		if isNotEnoughHosts(err) {
 			return resource.RetryableError(fmt.Errorf("not enough hosts"))
 		}
-		task, err = task.WaitForTask(client, false)
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
-		if task.State == "failed" {
-			return resource.NonRetryableError(fmt.Errorf("failed to Enable Shared storage: %s", task.Message))
+		_, err = waitForTask(ctx, client, task, d.Timeout(schema.TimeoutCreate))
+		if err != nil {
+			return resource.NonRetryableError(err)
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	cluster, err = client.GetCluster(clusterID)
+	var storage *rest.StoragePool
+	err = client.call(ctx, "GET cluster/"+clusterID, func(c *rest.Client) (err error) {
+		cluster, err = c.GetCluster(clusterID)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	storage, err := client.GetStoragePool(cluster.SharedStorage.ID)
+	err = client.call(ctx, "GET storage/pool/"+cluster.SharedStorage.ID, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(cluster.SharedStorage.ID)
+		return err
+	})
 	if err != nil {
 		return diag.Errorf("storage pool not found in database")
 	}
@@ -107,22 +123,30 @@ func resourceSharedStorageCreate(ctx context.Context, d *schema.ResourceData, m
 }
 
 func resourceSharedStorageRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	clusterID, err := client.ClusterID()
-	if err != nil {
-		return diag.FromErr(err)
-	}
-	cluster, err := client.GetCluster(clusterID)
+	client := m.(*hiveClient)
+	var cluster rest.Cluster
+	err := client.call(ctx, "GET cluster", func(c *rest.Client) error {
+		clusterID, err := c.ClusterID()
+		if err != nil {
+			return err
+		}
+		cluster, err = c.GetCluster(clusterID)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	if cluster.SharedStorage == nil || cluster.SharedStorage.ID == "" {
 		d.SetId("")
 		return diag.Diagnostics{}
 	}
-	storage, err := client.GetStoragePool(cluster.SharedStorage.ID)
+	var storage *rest.StoragePool
+	err = client.call(ctx, "GET storage/pool/"+cluster.SharedStorage.ID, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(cluster.SharedStorage.ID)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(storage.ID)
 	d.Set("name", storage.Name)
@@ -131,31 +155,47 @@ func resourceSharedStorageRead(ctx context.Context, d *schema.ResourceData, m in
 }
 
 func resourceSharedStorageDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	err := resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
-		clusterID, err := client.ClusterID()
+		var cluster rest.Cluster
+		err := client.call(ctx, "GET cluster", func(c *rest.Client) error {
+			clusterID, err := c.ClusterID()
+			if err != nil {
+				return err
+			}
+			cluster, err = c.GetCluster(clusterID)
+			return err
+		})
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
-		cluster, err := client.GetCluster(clusterID)
+		var task *rest.Task
+		err = client.callOnce(ctx, "POST cluster/"+cluster.ID+"/disableSharedStorage", func(c *rest.Client) (err error) {
+			task, err = cluster.DisableSharedStorage(c)
+			return err
+		})
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.RetryableError(classifyError(err))
 		}
-		task, err := cluster.DisableSharedStorage(client)
-		if err != nil {
-			return resource.RetryableError(err)
+		_, err = waitForTask(ctx, client, task, d.Timeout(schema.TimeoutDelete))
+		var taskErr *taskError
+		if errors.As(err, &taskErr) {
+			return resource.NonRetryableError(err)
 		}
-		task, err = task.WaitForTask(client, false)
 		if err != nil {
-			return resource.RetryableError(err)
-		}
-		if task.State == "failed" {
-			return resource.NonRetryableError(fmt.Errorf("failed to Disable Shared storage: %s", task.Message))
+			return resource.RetryableError(classifyError(err))
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
+
+// isNotEnoughHosts reports whether shared storage was rejected because the
+// cluster has fewer hosts than the minimum set size. The status code of this
+// error is not documented, so only the message is matched.
+func isNotEnoughHosts(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Not enough hosts")
+}
@@ -0,0 +1,64 @@
+package hiveio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceSharedStorage(t *testing.T) {
+	fake := newFakeHive(t)
+	for _, ip := range []string{"10.0.0.11", "10.0.0.12", "10.0.0.13"} {
+		fake.addHost(ip)
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_shared_storage",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_shared_storage.test", "name", "sharedStorage"),
+					resource.TestCheckResourceAttr("hiveio_shared_storage.test", "type", "gluster"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"utilization": 50,
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_shared_storage.test", "utilization", "50"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"minimum_set_size", "utilization"},
+		CheckDestroy: func(*terraform.State) error {
+			var err error
+			fake.update(func() {
+				if fake.cluster.SharedStorage != nil {
+					err = fmt.Errorf("shared storage is still enabled")
+				}
+			})
+			return err
+		},
+	})
+}
+
+func TestResourceSharedStorageWaitsForHosts(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	fake.addHost("10.0.0.12")
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_shared_storage",
+		Steps: []lifecycleStep{
+			{
+				PreConfig: func() {
+					time.AfterFunc(200*time.Millisecond, func() { fake.addHost("10.0.0.13") })
+				},
+				Config: map[string]interface{}{},
+				Check:  resource.TestCheckResourceAttr("hiveio_shared_storage.test", "name", "sharedStorage"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"minimum_set_size", "utilization"},
+	})
+}
@@ -3,12 +3,12 @@ package hiveio
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -20,6 +20,10 @@ func resourceStoragePool() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -28,9 +32,10 @@ func resourceStoragePool() *schema.Resource {
 				ForceNew: true,
 			},
 			"type": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice(storageTypes, false),
 			},
 			"url": {
 				Type:     schema.TypeString,
@@ -76,9 +81,11 @@ func resourceStoragePool() *schema.Resource {
 				Type:     schema.TypeList,
 				Required: true,
 				Elem: &schema.Schema{
-					Type: schema.TypeString,
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice(storageRoles, false),
 				},
-				ForceNew: true, //TODO: add update that only changes this field
+				// the api has no storage pool update, changing the roles replaces the pool
+				ForceNew: true,
 			},
 			"s3_access_key_id": {
 				Type:     schema.TypeString,
@@ -97,14 +104,11 @@ func resourceStoragePool() *schema.Resource {
 				ForceNew: true,
 			},
 		},
-		Timeouts: &schema.ResourceTimeout{
-			Delete: schema.DefaultTimeout(3 * time.Minute),
-		},
 	}
 }
 
 func resourceStoragePoolCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var storage *rest.StoragePool
 	storage = &rest.StoragePool{
 		Name: d.Get("name").(string),
@@ -147,28 +151,36 @@ func resourceStoragePoolCreate(ctx context.Context, d *schema.ResourceData, m in
 		storage.S3Region = s3Region.(string)
 	}
 
-	_, err := storage.Create(client)
+	err := client.callOnce(ctx, "POST storage/pools", func(c *rest.Client) error {
+		_, err := storage.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	storage, err = client.GetStoragePoolByName(storage.Name)
+	err = client.call(ctx, "GET storage/pools?name="+storage.Name, func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePoolByName(storage.Name)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(storage.ID)
 	return resourceStoragePoolRead(ctx, d, m)
 }
 
 func resourceStoragePoolRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var storage *rest.StoragePool
-	var err error
-	storage, err = client.GetStoragePool(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err := client.call(ctx, "GET storage/pool/"+d.Id(), func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(storage.ID)
 	d.Set("name", storage.Name)
@@ -180,31 +192,39 @@ func resourceStoragePoolRead(ctx context.Context, d *schema.ResourceData, m inte
 	//d.Set("password", storage.Password)
 	//d.Set("key", storage.Key)
 	d.Set("roles", storage.Roles)
-	d.Set("s3_acess_key_id", storage.S3AccessKeyID)
+	d.Set("s3_access_key_id", storage.S3AccessKeyID)
 	d.Set("s3_region", storage.S3Region)
 	return diag.Diagnostics{}
 }
 
 func resourceStoragePoolDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	storage, err := client.GetStoragePool(d.Id())
+	client := m.(*hiveClient)
+	var storage *rest.StoragePool
+	err := client.call(ctx, "GET storage/pool/"+d.Id(), func(c *rest.Client) (err error) {
+		storage, err = c.GetStoragePool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	//{"error": 423, "message": {"code":"LockedError","message":"Storage pool vms is in use and can not be deleted"}}
 	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
-		err = storage.Delete(client)
-		if err != nil && strings.Contains(err.Error(), "\"error\": 423") {
-			time.Sleep(2 * time.Second)
+		err := client.call(ctx, "DELETE storage/pool/"+d.Id(), func(c *rest.Client) error {
+			return storage.Delete(c)
+		})
+		if isLocked(err) {
 			return resource.RetryableError(fmt.Errorf("storage Pool %s is in use", d.Id()))
 		}
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
@@ -0,0 +1,132 @@
+package hiveio
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceStoragePool(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_storage_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":   "nfs1",
+					"type":   "nfs",
+					"server": "nas.example.com",
+					"path":   "/exports/vms",
+					"roles":  []interface{}{"guests"},
+				},
+				ExpectError: regexp.MustCompile(`expected roles.0 to be one of`),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":   "nfs1",
+					"type":   "nfs",
+					"server": "nas.example.com",
+					"path":   "/exports/vms",
+					"roles":  []interface{}{"guest", "template"},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_storage_pool.test", "id"),
+					resource.TestCheckResourceAttr("hiveio_storage_pool.test", "roles.#", "2"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":     "cifs1",
+					"type":     "cifs",
+					"server":   "nas.example.com",
+					"path":     "share",
+					"username": "hive",
+					"password": "secret",
+					"roles":    []interface{}{"backup"},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_storage_pool.test", "type", "cifs"),
+					resource.TestCheckResourceAttr("hiveio_storage_pool.test", "roles.0", "backup"),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"password"},
+	})
+}
+
+func TestResourceStoragePoolDeleteLocked(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	fake.failNext("DELETE", "storage/pool/"+storage.ID, 423,
+		`{"code":"LockedError","message":"Storage pool vms is in use and can not be deleted"}`)
+
+	r := resourceStoragePool()
+	d := r.TestResourceData()
+	d.SetId(storage.ID)
+	if diags := r.DeleteContext(context.Background(), d, testClient(t, fake)); diags.HasError() {
+		t.Fatal(diagsError(diags))
+	}
+	if fake.requestCount("DELETE", "storage/pool/"+storage.ID) != 2 {
+		t.Fatal("expected delete to be retried while the storage pool is locked")
+	}
+}
+
+func TestResourceStoragePoolReplace(t *testing.T) {
+	fake := newFakeHive(t)
+	config := func(password string, roles ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name":     "cifs1",
+			"type":     "cifs",
+			"server":   "nas.example.com",
+			"path":     "share",
+			"username": "hive",
+			"password": password,
+			"roles":    roles,
+		}
+	}
+	var ids []string
+	checkStorage := func(password string, roles int) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			id := s.RootModule().Resources["hiveio_storage_pool.test"].Primary.ID
+			ids = append(ids, id)
+			var storage struct {
+				password string
+				roles    int
+			}
+			fake.update(func() {
+				storage.password = fake.storagePools[id].Password
+				storage.roles = len(fake.storagePools[id].Roles)
+			})
+			if storage.password != password || storage.roles != roles {
+				return fmt.Errorf("storage pool has password %q and %d roles", storage.password, storage.roles)
+			}
+			return nil
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_storage_pool",
+		Steps: []lifecycleStep{
+			{
+				Config: config("secret", "guest"),
+				Check:  checkStorage("secret", 1),
+			},
+			{
+				Config: config("rotated", "guest", "backup"),
+				Check: resource.ComposeTestCheckFunc(
+					checkStorage("rotated", 2),
+					func(*terraform.State) error {
+						if ids[len(ids)-1] == ids[len(ids)-2] {
+							return fmt.Errorf("expected the storage pool to be replaced")
+						}
+						return nil
+					},
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"password"},
+	})
+}
@@ -3,11 +3,11 @@ package hiveio
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -20,6 +20,12 @@ func resourceTemplate() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Read:   schema.DefaultTimeout(time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -38,14 +44,16 @@ func resourceTemplate() *schema.Resource {
 				Optional: true,
 			},
 			"firmware": {
-				Type:     schema.TypeString,
-				Default:  "uefi",
-				Optional: true,
+				Type:         schema.TypeString,
+				Default:      "uefi",
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(firmwareTypes, false),
 			},
 			"display_driver": {
-				Type:     schema.TypeString,
-				Default:  "cirrus",
-				Optional: true,
+				Type:         schema.TypeString,
+				Default:      "cirrus",
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(displayDrivers, false),
 			},
 			"os": {
 				Type:     schema.TypeString,
@@ -70,9 +78,10 @@ func resourceTemplate() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"type": {
-							Type:     schema.TypeString,
-							Default:  "Disk",
-							Optional: true,
+							Type:         schema.TypeString,
+							Default:      "Disk",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskTypes, true),
 						},
 						"storage_id": {
 							Type:     schema.TypeString,
@@ -83,14 +92,16 @@ func resourceTemplate() *schema.Resource {
 							Required: true,
 						},
 						"disk_driver": {
-							Type:     schema.TypeString,
-							Default:  "virtio",
-							Optional: true,
+							Type:         schema.TypeString,
+							Default:      "virtio",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskDrivers, false),
 						},
 						"format": {
-							Type:     schema.TypeString,
-							Default:  "qcow2",
-							Optional: true,
+							Type:         schema.TypeString,
+							Default:      "qcow2",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskFormats, false),
 						},
 						"size": {
 							Type:     schema.TypeString,
@@ -113,17 +124,15 @@ func resourceTemplate() *schema.Resource {
 							Required: true,
 						},
 						"emulation": {
-							Type:     schema.TypeString,
-							Default:  "virtio",
-							Optional: true,
+							Type:         schema.TypeString,
+							Default:      "virtio",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(nicEmulations, false),
 						},
 					},
 				},
 			},
 		},
-		Timeouts: &schema.ResourceTimeout{
-			Read: schema.DefaultTimeout(time.Minute),
-		},
 	}
 }
 
@@ -172,24 +181,31 @@ func templateFromResource(d *schema.ResourceData) rest.Template {
 }
 
 func resourceTemplateCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	template := templateFromResource(d)
-	_, err := template.Create(client)
+	err := client.callOnce(ctx, "POST templates", func(c *rest.Client) error {
+		_, err := template.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(template.Name)
 	return resourceTemplateRead(ctx, d, m)
 }
 
 func resourceTemplateRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	template, err := client.GetTemplate(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	client := m.(*hiveClient)
+	var template rest.Template
+	err := client.call(ctx, "GET template/"+d.Id(), func(c *rest.Client) (err error) {
+		template, err = c.GetTemplate(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	d.Set("name", template.Name)
@@ -200,44 +216,62 @@ func resourceTemplateRead(ctx context.Context, d *schema.ResourceData, m interfa
 	d.Set("os", template.OS)
 	d.Set("manual_agent_install", template.ManualAgentInstall)
 
-	for i, disk := range template.Disks {
-		prefix := fmt.Sprintf("disk.%d.", i)
-		d.Set(prefix+"disk_driver", disk.DiskDriver)
-		d.Set(prefix+"type", disk.Type)
-		d.Set(prefix+"storage_id", disk.StorageID)
-		d.Set(prefix+"filename", disk.Filename)
-		d.Set(prefix+"format", disk.Format)
+	var disks []interface{}
+	for _, disk := range template.Disks {
+		disks = append(disks, map[string]interface{}{
+			"disk_driver": disk.DiskDriver,
+			"type":        disk.Type,
+			"storage_id":  disk.StorageID,
+			"filename":    disk.Filename,
+			"format":      disk.Format,
+		})
 	}
+	d.Set("disk", disks)
 
-	for i, iface := range template.Interfaces {
-		prefix := fmt.Sprintf("interface.%d.", i)
-		d.Set(prefix+"emulation", iface.Emulation)
-		d.Set(prefix+"network", iface.Network)
-		d.Set(prefix+"vlan", iface.Vlan)
+	var interfaces []interface{}
+	for _, iface := range template.Interfaces {
+		interfaces = append(interfaces, map[string]interface{}{
+			"emulation": iface.Emulation,
+			"network":   iface.Network,
+			"vlan":      iface.Vlan,
+		})
 	}
+	d.Set("interface", interfaces)
 
 	return diag.Diagnostics{}
 }
 
 func resourceTemplateUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	template := templateFromResource(d)
-	_, err := template.Update(client)
+	err := client.call(ctx, "PUT template/"+d.Id(), func(c *rest.Client) error {
+		_, err := template.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return resourceTemplateRead(ctx, d, m)
 }
 
 func resourceTemplateDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	template, err := client.GetTemplate(d.Id())
+	client := m.(*hiveClient)
+	var template rest.Template
+	err := client.call(ctx, "GET template/"+d.Id(), func(c *rest.Client) (err error) {
+		template, err = c.GetTemplate(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = template.Delete(client)
+	err = client.call(ctx, "DELETE template/"+d.Id(), func(c *rest.Client) error {
+		return template.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
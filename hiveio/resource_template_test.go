@@ -0,0 +1,73 @@
+package hiveio
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestResourceTemplate(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("templates")
+	fake.addDisk(storage.ID, "win10.qcow2", "qcow2", 40)
+
+	disk := map[string]interface{}{
+		"storage_id": storage.ID,
+		"filename":   "win10.qcow2",
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_template",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"name":     "win10",
+					"os":       "win10",
+					"firmware": "efi",
+					"disk":     []interface{}{disk},
+				},
+				ExpectError: regexp.MustCompile(`expected firmware to be one of \[uefi bios\]`),
+			},
+			{
+				Config: map[string]interface{}{
+					"name": "win10",
+					"os":   "win10",
+					"disk": []interface{}{disk},
+					"interface": []interface{}{
+						map[string]interface{}{
+							"network": "prod",
+							"vlan":    0,
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_template.test", "id", "win10"),
+					resource.TestCheckResourceAttr("hiveio_template.test", "cpu", "2"),
+					resource.TestCheckResourceAttr("hiveio_template.test", "disk.0.filename", "win10.qcow2"),
+					resource.TestCheckResourceAttr("hiveio_template.test", "interface.0.network", "prod"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"name":           "win10",
+					"os":             "win10",
+					"cpu":            4,
+					"mem":            8192,
+					"display_driver": "qxl",
+					"disk":           []interface{}{disk},
+					"interface": []interface{}{
+						map[string]interface{}{
+							"network": "prod",
+							"vlan":    10,
+						},
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_template.test", "cpu", "4"),
+					resource.TestCheckResourceAttr("hiveio_template.test", "mem", "8192"),
+					resource.TestCheckResourceAttr("hiveio_template.test", "interface.0.vlan", "10"),
+				),
+			},
+		},
+	})
+}
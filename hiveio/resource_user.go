@@ -3,11 +3,12 @@ package hiveio
 import (
 	"context"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -18,9 +19,15 @@ func resourceUser() *schema.Resource {
 		ReadContext:   resourceUserRead,
 		UpdateContext: resourceUserUpdate,
 		DeleteContext: resourceUserDelete,
+		CustomizeDiff: resourceUserCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"username": {
@@ -36,20 +43,36 @@ func resourceUser() *schema.Resource {
 				Required: true,
 			},
 			"role": {
-				Description: "readonly or admin",
-				Type:        schema.TypeString,
-				Required:    true,
+				Description:  "readonly or admin",
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice(userRoles, false),
 			},
 		},
 	}
 }
 
+// resourceUserCustomizeDiff requires exactly one of username and groupname.
+func resourceUserCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	username, groupname := diffIsSet(d, "username"), diffIsSet(d, "groupname")
+	if username && groupname {
+		return fmt.Errorf("only one of username or groupname can be set")
+	}
+	if !username && !groupname {
+		return fmt.Errorf("one of username or groupname must be set")
+	}
+	return nil
+}
+
 func userFromResource(d *schema.ResourceData) (*rest.User, error) {
 	user := rest.User{
 		ID:    uuid.New().String(),
 		Realm: d.Get("realm").(string),
 		Role:  d.Get("role").(string),
 	}
+	if d.Id() != "" {
+		user.ID = d.Id()
+	}
 
 	if username, ok := d.GetOk("username"); ok {
 		user.Username = username.(string)
@@ -62,30 +85,35 @@ func userFromResource(d *schema.ResourceData) (*rest.User, error) {
 }
 
 func resourceUserCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	user, err := userFromResource(d)
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
-	_, err = user.Create(client)
+	err = client.callOnce(ctx, "POST users", func(c *rest.Client) error {
+		_, err := user.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(user.ID)
 	return resourceUserRead(ctx, d, m)
 }
 
 func resourceUserRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	var user *rest.User
-	var err error
-	user, err = client.GetUser(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	err := client.call(ctx, "GET user/"+d.Id(), func(c *rest.Client) (err error) {
+		user, err = c.GetUser(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	if user.Username != "" {
 		d.Set("username", user.Username)
@@ -99,27 +127,39 @@ func resourceUserRead(ctx context.Context, d *schema.ResourceData, m interface{}
 }
 
 func resourceUserUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	user, err := userFromResource(d)
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	_, err = user.Update(client)
+	err = client.call(ctx, "PUT user/"+d.Id(), func(c *rest.Client) error {
+		_, err := user.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return resourceUserRead(ctx, d, m)
 }
 
 func resourceUserDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	user, err := client.GetUser(d.Id())
+	client := m.(*hiveClient)
+	var user *rest.User
+	err := client.call(ctx, "GET user/"+d.Id(), func(c *rest.Client) (err error) {
+		user, err = c.GetUser(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = user.Delete(client)
+	err = client.call(ctx, "DELETE user/"+d.Id(), func(c *rest.Client) error {
+		return user.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
@@ -0,0 +1,77 @@
+package hiveio
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestResourceUser(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_user",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"username":  "jdoe",
+					"groupname": "hive admins",
+					"realm":     "TEST",
+					"role":      "readonly",
+				},
+				ExpectError: regexp.MustCompile("only one of username or groupname can be set"),
+			},
+			{
+				Config: map[string]interface{}{
+					"realm": "TEST",
+					"role":  "readonly",
+				},
+				ExpectError: regexp.MustCompile("one of username or groupname must be set"),
+			},
+			{
+				Config: map[string]interface{}{
+					"username": "jdoe",
+					"realm":    "TEST",
+					"role":     "reader",
+				},
+				ExpectError: regexp.MustCompile(`expected role to be one of \[readonly admin\]`),
+			},
+			{
+				Config: map[string]interface{}{
+					"username": "jdoe",
+					"realm":    "TEST",
+					"role":     "readonly",
+				},
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_user.test", "id"),
+					resource.TestCheckResourceAttr("hiveio_user.test", "role", "readonly"),
+				),
+			},
+			{
+				Config: map[string]interface{}{
+					"username": "jdoe",
+					"realm":    "TEST",
+					"role":     "admin",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_user.test", "role", "admin"),
+			},
+		},
+	})
+}
+
+func TestResourceUserGroup(t *testing.T) {
+	fake := newFakeHive(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_user",
+		Steps: []lifecycleStep{
+			{
+				Config: map[string]interface{}{
+					"groupname": "hive admins",
+					"realm":     "TEST",
+					"role":      "admin",
+				},
+				Check: resource.TestCheckResourceAttr("hiveio_user.test", "groupname", "hive admins"),
+			},
+		},
+	})
+}
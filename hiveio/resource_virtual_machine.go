@@ -3,12 +3,14 @@ package hiveio
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/hive-io/hive-go-client/rest"
 )
 
@@ -19,10 +21,11 @@ func resourceVM() *schema.Resource {
 		UpdateContext: resourceVMUpdate,
 		DeleteContext: resourceVMDelete,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceVMImport,
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
 			Delete: schema.DefaultTimeout(10 * time.Minute),
 		},
 
@@ -45,14 +48,16 @@ func resourceVM() *schema.Resource {
 				Optional: true,
 			},
 			"firmware": {
-				Type:     schema.TypeString,
-				Default:  "uefi",
-				Optional: true,
+				Type:         schema.TypeString,
+				Default:      "uefi",
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(firmwareTypes, false),
 			},
 			"display_driver": {
-				Type:     schema.TypeString,
-				Default:  "cirrus",
-				Optional: true,
+				Type:         schema.TypeString,
+				Default:      "cirrus",
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(displayDrivers, false),
 			},
 			"os": {
 				Type:     schema.TypeString,
@@ -64,36 +69,36 @@ func resourceVM() *schema.Resource {
 				Optional: true,
 			},
 			"disk": {
-				Type:     schema.TypeList,
-				Optional: true,
+				Description: "The disks of the guest in boot order. Disks can be added, removed and reordered without replacing the guest.",
+				Type:        schema.TypeList,
+				Optional:    true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"type": {
-							Type:     schema.TypeString,
-							Default:  "Disk",
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Default:      "Disk",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskTypes, true),
 						},
 						"storage_id": {
 							Type:     schema.TypeString,
 							Required: true,
-							ForceNew: true,
 						},
 						"filename": {
 							Type:     schema.TypeString,
 							Required: true,
-							ForceNew: true,
 						},
 						"disk_driver": {
-							Type:     schema.TypeString,
-							Default:  "virtio",
-							Optional: true,
+							Type:         schema.TypeString,
+							Default:      "virtio",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskDrivers, false),
 						},
 						"format": {
-							Type:     schema.TypeString,
-							Default:  "qcow2",
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Default:      "qcow2",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(diskFormats, false),
 						},
 						"size": {
 							Type:     schema.TypeString,
@@ -103,8 +108,9 @@ func resourceVM() *schema.Resource {
 				},
 			},
 			"interface": {
-				Type:     schema.TypeList,
-				Optional: true,
+				Description: "The network interfaces of the guest. Interfaces can be added, removed and reordered without replacing the guest.",
+				Type:        schema.TypeList,
+				Optional:    true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"network": {
@@ -116,9 +122,19 @@ func resourceVM() *schema.Resource {
 							Required: true,
 						},
 						"emulation": {
+							Type:         schema.TypeString,
+							Default:      "virtio",
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(nicEmulations, false),
+						},
+						"mac_address": {
 							Type:     schema.TypeString,
-							Default:  "virtio",
-							Optional: true,
+							Computed: true,
+						},
+						"ip_address": {
+							Description: "The ip address reported by the guest agent.",
+							Type:        schema.TypeString,
+							Computed:    true,
 						},
 					},
 				},
@@ -134,8 +150,9 @@ func resourceVM() *schema.Resource {
 							Required: true,
 						},
 						"frequency": {
-							Type:     schema.TypeString,
-							Required: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringInSlice(backupFrequency, false),
 						},
 						"target": {
 							Type:     schema.TypeString,
@@ -166,6 +183,57 @@ func resourceVM() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"power_state": {
+				Description:  "The power state of the guest, `running` or `stopped`. A guest suspended outside of terraform is read as `suspended` and powered on or shut down to match. A guest in any other state, for example building or failed, is read as `unknown`. `suspended` can not be configured because the hive api has no action to suspend a guest.",
+				Type:         schema.TypeString,
+				Default:      "running",
+				Optional:     true,
+				ValidateFunc: validatePowerState,
+			},
+			"reboot_trigger": {
+				Description: "Any value, the running guest is rebooted when it changes. The reboot also applies disk and interface changes that could not be hot-plugged.",
+				Type:        schema.TypeString,
+				Optional:    true,
+			},
+			"graceful_shutdown_timeout": {
+				Description: "Seconds to wait for the guest to shut down before it is powered off.",
+				Type:        schema.TypeInt,
+				Default:     300,
+				Optional:    true,
+			},
+			"wait_for_ip": {
+				Description: "Wait for the guest agent to report an ip address after the guest is created or powered on.",
+				Type:        schema.TypeBool,
+				Default:     false,
+				Optional:    true,
+			},
+			"guest_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"ip_address": {
+				Description: "The first ip address reported by the guest agent.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"host_id": {
+				Description: "The id of the host the guest is running on.",
+				Type:        schema.TypeString,
+				Computed:    true,
+			},
+			"guest_state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"agent_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"pending_reboot": {
+				Description: "Whether the running guest has to be rebooted for disk and interface changes that could not be hot-plugged.",
+				Type:        schema.TypeBool,
+				Computed:    true,
+			},
 		},
 	}
 }
@@ -253,29 +321,37 @@ func vmFromResource(d *schema.ResourceData) *rest.Pool {
 }
 
 func resourceVMCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	pool := vmFromResource(d)
 
-	_, err := pool.Create(client)
+	err := client.callOnce(ctx, "POST pools", func(c *rest.Client) error {
+		_, err := pool.Create(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	pool, err = client.GetPoolByName(pool.Name)
+	err = client.call(ctx, "GET pools?name="+pool.Name, func(c *rest.Client) (err error) {
+		pool, err = c.GetPoolByName(pool.Name)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
-	guestName := strings.ToUpper(pool.Name)
-	guestName = strings.ReplaceAll(guestName, " ", "_")
+	guestName := vmGuestName(pool.Name)
 	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutCreate), func() *resource.RetryError {
-		guest, err := client.GetGuest(guestName)
+		var guest *rest.Guest
+		err := client.call(ctx, "GET guest/"+guestName, func(c *rest.Client) (err error) {
+			guest, err = c.GetGuest(guestName)
+			return err
+		})
 		if err != nil {
-			if strings.Contains(err.Error(), "\"error\": 404") {
-				time.Sleep(5 * time.Second)
+			if isNotFound(err) {
 				return resource.RetryableError(fmt.Errorf("building pool %s", pool.ID))
 			}
 			if err != nil {
-				return resource.NonRetryableError(err)
+				return resource.NonRetryableError(classifyError(err))
 			}
 			return nil
 		}
@@ -284,27 +360,41 @@ func resourceVMCreate(ctx context.Context, d *schema.ResourceData, m interface{}
 				return nil
 			}
 		}
-		err = guest.WaitForGuest(client, d.Timeout(schema.TimeoutCreate))
+		err = client.call(ctx, "GET socket.io/ (guest "+guestName+")", func(c *rest.Client) error {
+			return guest.WaitForGuest(c, d.Timeout(schema.TimeoutCreate))
+		})
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	d.SetId(pool.ID)
+	err = setVMPowerState(ctx, d, client, guestName, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	err = waitForVMIPAddress(ctx, d, client, guestName, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diagFromErr(err)
+	}
 	return resourceVMRead(ctx, d, m)
 }
 
 func resourceVMRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	pool, err := client.GetPool(d.Id())
-	if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
+	client := m.(*hiveClient)
+	var pool *rest.Pool
+	err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+		pool, err = c.GetPool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
 		d.SetId("")
 		return diag.Diagnostics{}
 	} else if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 
 	d.Set("name", pool.Name)
@@ -316,77 +406,416 @@ func resourceVMRead(ctx context.Context, d *schema.ResourceData, m interface{})
 	d.Set("firmware", pool.GuestProfile.Firmware)
 	d.Set("display_driver", pool.GuestProfile.Vga)
 
-	for i, disk := range pool.GuestProfile.Disks {
-		prefix := fmt.Sprintf("disk.%d.", i)
-		d.Set(prefix+"disk_driver", disk.DiskDriver)
-		d.Set(prefix+"type", disk.Type)
-		d.Set(prefix+"storage_id", disk.StorageID)
-		d.Set(prefix+"filename", disk.Filename)
+	// the disk format is not stored in the pool
+	formats := map[string]string{}
+	for _, v := range d.Get("disk").([]interface{}) {
+		if disk, ok := v.(map[string]interface{}); ok {
+			formats[disk["storage_id"].(string)+"/"+disk["filename"].(string)] = disk["format"].(string)
+		}
+	}
+	var disks []interface{}
+	for _, disk := range pool.GuestProfile.Disks {
+		format := formats[disk.StorageID+"/"+disk.Filename]
+		if format == "" {
+			format = "qcow2"
+		}
+		disks = append(disks, map[string]interface{}{
+			"disk_driver": disk.DiskDriver,
+			"type":        disk.Type,
+			"storage_id":  disk.StorageID,
+			"filename":    disk.Filename,
+			"format":      format,
+		})
 	}
+	d.Set("disk", disks)
 
-	for i, iface := range pool.GuestProfile.Interfaces {
-		prefix := fmt.Sprintf("interface.%d.", i)
-		d.Set(prefix+"emulation", iface.Emulation)
-		d.Set(prefix+"network", iface.Network)
-		d.Set(prefix+"vlan", iface.Vlan)
+	var guest *rest.Guest
+	err = client.call(ctx, "GET guest/"+vmGuestName(pool.Name), func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(vmGuestName(pool.Name))
+		return err
+	})
+	if err != nil && !isNotFound(err) {
+		return diagFromErr(err)
 	}
 
-	if pool.GuestProfile.CloudInit != nil {
-		d.Set("cloudinit_enabled", pool.GuestProfile.CloudInit.Enabled)
-		d.Set("cloudinit_userdata", pool.GuestProfile.CloudInit.UserData)
-		d.Set("cloudinit_networkconfig", pool.GuestProfile.CloudInit.NetworkConfig)
+	var guestInterfaces []*rest.GuestNetwork
+	if guest != nil {
+		guestInterfaces = matchGuestInterfaces(pool.GuestProfile.Interfaces, guest.Interfaces)
 	}
+	var interfaces []interface{}
+	for i, iface := range pool.GuestProfile.Interfaces {
+		var macAddress, ipAddress string
+		if i < len(guestInterfaces) && guestInterfaces[i] != nil {
+			macAddress = guestInterfaces[i].MacAddress
+			ipAddress = guestInterfaces[i].IPAddress
+		}
+		interfaces = append(interfaces, map[string]interface{}{
+			"emulation":   iface.Emulation,
+			"network":     iface.Network,
+			"vlan":        vlanFromInterface(iface.Vlan),
+			"mac_address": macAddress,
+			"ip_address":  ipAddress,
+		})
+	}
+	d.Set("interface", interfaces)
 
-	if pool.Backup != nil {
-		d.Set("backup.0.enabled", pool.Backup.Enabled)
-		d.Set("backup.0.frequency", pool.Backup.Frequency)
-		d.Set("backup.0.target", pool.Backup.TargetStorageID)
+	cloudInit := pool.GuestProfile.CloudInit
+	if cloudInit == nil {
+		cloudInit = &rest.PoolCloudInit{}
 	}
+	d.Set("cloudinit_enabled", cloudInit.Enabled)
+	d.Set("cloudinit_userdata", cloudInit.UserData)
+	d.Set("cloudinit_networkconfig", cloudInit.NetworkConfig)
+
+	d.Set("backup", flattenPoolBackup(pool.Backup))
 
-	if pool.PoolAffinity != nil && len(pool.PoolAffinity.AllowedHostIDs) > 0 {
-		d.Set("allowed_hosts", pool.PoolAffinity.AllowedHostIDs)
+	var allowedHosts []string
+	if pool.PoolAffinity != nil {
+		allowedHosts = pool.PoolAffinity.AllowedHostIDs
 	}
+	d.Set("allowed_hosts", allowedHosts)
 
+	d.Set("guest_name", vmGuestName(pool.Name))
+	// the guest record is missing while the pool rebuilds it
+	if guest != nil {
+		d.Set("power_state", guestPowerState(guest))
+		d.Set("ip_address", guestIPAddress(guest))
+		d.Set("host_id", guest.Hostid)
+		d.Set("guest_state", guest.GuestState)
+		d.Set("agent_version", guest.AgentVersion)
+		d.Set("pending_reboot", guestPowerState(guest) == "running" && !guestDevicesMatch(guest, pool))
+	}
 	return diag.Diagnostics{}
 }
 
+// matchGuestInterfaces returns the interface of the guest for each interface
+// of the pool. Interfaces are matched by network and vlan because the guest
+// keeps its old interfaces until changes that can not be hot-plugged are
+// applied by a reboot.
+func matchGuestInterfaces(interfaces []*rest.PoolInterface, guestInterfaces []rest.GuestNetwork) []*rest.GuestNetwork {
+	used := make([]bool, len(guestInterfaces))
+	matched := make([]*rest.GuestNetwork, len(interfaces))
+	for i, iface := range interfaces {
+		for j := range guestInterfaces {
+			if !used[j] && guestInterfaces[j].NetworkType == iface.Network && guestInterfaces[j].Vlan == vlanFromInterface(iface.Vlan) {
+				used[j] = true
+				matched[i] = &guestInterfaces[j]
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// guestDevicesMatch reports whether the guest has the disks and interfaces of
+// its pool in the same order.
+func guestDevicesMatch(guest *rest.Guest, pool *rest.Pool) bool {
+	if len(guest.Disks) != len(pool.GuestProfile.Disks) || len(guest.Interfaces) != len(pool.GuestProfile.Interfaces) {
+		return false
+	}
+	for i, disk := range pool.GuestProfile.Disks {
+		if guest.Disks[i].StorageID != disk.StorageID || guest.Disks[i].Filename != disk.Filename || guest.Disks[i].DiskDriver != disk.DiskDriver {
+			return false
+		}
+	}
+	for i, iface := range pool.GuestProfile.Interfaces {
+		if guest.Interfaces[i].NetworkType != iface.Network || guest.Interfaces[i].Vlan != vlanFromInterface(iface.Vlan) || guest.Interfaces[i].Emulation != iface.Emulation {
+			return false
+		}
+	}
+	return true
+}
+
+// vlanFromInterface converts the vlan of a pool interface, which is decoded
+// from json as a float64, to an int.
+func vlanFromInterface(vlan interface{}) int {
+	switch v := vlan.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// resourceVMUpdate applies all changes, including added, removed and
+// reordered disks and interfaces, with a pool update. Device changes that the
+// running guest can not hot-plug are reported as a warning.
 func resourceVMUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
+	client := m.(*hiveClient)
 	pool := vmFromResource(d)
-	_, err := pool.Update(client)
+	guestName := vmGuestName(pool.Name)
+	devicesChanged := d.HasChanges("disk", "interface")
+	if devicesChanged {
+		logVMDeviceChanges(d, guestName)
+	}
+	err := client.call(ctx, "PUT pool/"+d.Id(), func(c *rest.Client) error {
+		_, err := pool.Update(c)
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	return resourceVMRead(ctx, d, m)
+	err = setVMPowerState(ctx, d, client, guestName, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	err = waitForVMIPAddress(ctx, d, client, guestName, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diagFromErr(err)
+	}
+	diags := resourceVMRead(ctx, d, m)
+	if devicesChanged && d.Get("pending_reboot").(bool) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Guest %s must be rebooted", guestName),
+			Detail:   "The disk and interface changes could not be hot-plugged into the running guest, they are applied when the guest is rebooted, for example by changing reboot_trigger.",
+		})
+	}
+	return diags
+}
+
+// logVMDeviceChanges logs the disks and interfaces that are added, removed
+// or moved by an update.
+func logVMDeviceChanges(d *schema.ResourceData, guestName string) {
+	deviceKeys := map[string]func(map[string]interface{}) string{
+		"disk": func(m map[string]interface{}) string {
+			return fmt.Sprintf("%s/%s", m["storage_id"], m["filename"])
+		},
+		"interface": func(m map[string]interface{}) string {
+			return fmt.Sprintf("%s vlan %d", m["network"], m["vlan"])
+		},
+	}
+	keys := func(attr string, v interface{}) []string {
+		var result []string
+		for _, item := range v.([]interface{}) {
+			result = append(result, deviceKeys[attr](item.(map[string]interface{})))
+		}
+		return result
+	}
+	for _, attr := range []string{"disk", "interface"} {
+		o, n := d.GetChange(attr)
+		old, new := keys(attr, o), keys(attr, n)
+		for i, key := range new {
+			switch j := indexOf(old, key); {
+			case j < 0:
+				log.Printf("[INFO] Adding %s %s to guest %s", attr, key, guestName)
+			case j != i:
+				log.Printf("[INFO] Moving %s %s of guest %s from position %d to %d", attr, key, guestName, j, i)
+			}
+		}
+		for _, key := range old {
+			if indexOf(new, key) < 0 {
+				log.Printf("[INFO] Removing %s %s from guest %s", attr, key, guestName)
+			}
+		}
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// resourceVMImport sets the arguments that are not stored in the pool to
+// their defaults.
+func resourceVMImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	d.Set("graceful_shutdown_timeout", 300)
+	d.Set("wait_for_ip", false)
+	return []*schema.ResourceData{d}, nil
+}
+
+// vmGuestName returns the name of the guest created for a standalone pool.
+func vmGuestName(name string) string {
+	return strings.ReplaceAll(strings.ToUpper(name), " ", "_")
+}
+
+// powerStates are the values guestPowerState returns for known guest states.
+// The hive api has no action to suspend a guest, so suspended can be read but
+// not configured.
+var powerStates = []string{"running", "stopped", "suspended"}
+
+// unknownPowerState is read for guests that are building, failed or in any
+// other state, it never matches the configured power_state.
+const unknownPowerState = "unknown"
+
+// validatePowerState checks that power_state is a state the provider can
+// put a guest into.
+func validatePowerState(i interface{}, k string) ([]string, []error) {
+	if warnings, errs := validation.StringInSlice(powerStates, false)(i, k); len(errs) > 0 {
+		return warnings, errs
+	}
+	if i.(string) == "suspended" {
+		return nil, []error{fmt.Errorf("%s can not be suspended, the hive api has no action to suspend a guest", k)}
+	}
+	return nil, nil
+}
+
+// guestPowerState maps the state of a guest to a power_state value.
+func guestPowerState(guest *rest.Guest) string {
+	switch strings.ToLower(guest.GuestState) {
+	case "ready", "running":
+		return "running"
+	case "stopped", "shutoff", "poweredoff", "off":
+		return "stopped"
+	case "paused", "suspended", "pmsuspended":
+		return "suspended"
+	}
+	return unknownPowerState
+}
+
+// setVMPowerState starts or stops the guest to match power_state. A guest
+// that does not shut down within graceful_shutdown_timeout is powered off.
+// A running guest is rebooted when reboot_trigger changed.
+func setVMPowerState(ctx context.Context, d *schema.ResourceData, client *hiveClient, guestName string, timeout time.Duration) error {
+	state := d.Get("power_state").(string)
+	var guest *rest.Guest
+	err := client.call(ctx, "GET guest/"+guestName, func(c *rest.Client) (err error) {
+		guest, err = c.GetGuest(guestName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if guestPowerState(guest) == state {
+		if state != "running" || d.IsNewResource() || !d.HasChange("reboot_trigger") {
+			return nil
+		}
+		log.Printf("[INFO] Rebooting guest %s", guestName)
+		err = client.callOnce(ctx, "POST guest/"+guestName+"/reboot", func(c *rest.Client) error {
+			return guest.Reboot(c)
+		})
+		if err != nil {
+			return err
+		}
+		return waitForVMPowerState(ctx, client, guestName, state, timeout)
+	}
+
+	if state == "running" {
+		log.Printf("[INFO] Powering on guest %s", guestName)
+		err = client.callOnce(ctx, "POST guest/"+guestName+"/poweron", func(c *rest.Client) error {
+			return guest.Poweron(c)
+		})
+		if err != nil {
+			return err
+		}
+		return waitForVMPowerState(ctx, client, guestName, state, timeout)
+	}
+
+	log.Printf("[INFO] Shutting down guest %s", guestName)
+	err = client.callOnce(ctx, "POST guest/"+guestName+"/shutdown", func(c *rest.Client) error {
+		return guest.Shutdown(c)
+	})
+	if err != nil {
+		return err
+	}
+	shutdownTimeout := time.Duration(d.Get("graceful_shutdown_timeout").(int)) * time.Second
+	err = waitForVMPowerState(ctx, client, guestName, state, shutdownTimeout)
+	if err == nil {
+		return nil
+	}
+	log.Printf("[WARN] Guest %s did not shut down in %s, powering off: %s", guestName, shutdownTimeout, err)
+	err = client.callOnce(ctx, "POST guest/"+guestName+"/poweroff", func(c *rest.Client) error {
+		return guest.Poweroff(c)
+	})
+	if err != nil {
+		return err
+	}
+	return waitForVMPowerState(ctx, client, guestName, state, timeout)
+}
+
+func waitForVMPowerState(ctx context.Context, client *hiveClient, guestName, state string, timeout time.Duration) error {
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var guest *rest.Guest
+		err := client.call(ctx, "GET guest/"+guestName, func(c *rest.Client) (err error) {
+			guest, err = c.GetGuest(guestName)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		if guestPowerState(guest) != state {
+			return resource.RetryableError(fmt.Errorf("guest %s is %s", guestName, guest.GuestState))
+		}
+		return nil
+	})
+}
+
+// guestIPAddress returns the first ip address reported by the guest agent.
+func guestIPAddress(guest *rest.Guest) string {
+	for _, iface := range guest.Interfaces {
+		if iface.IPAddress != "" {
+			return iface.IPAddress
+		}
+	}
+	return guest.Address
+}
+
+// waitForVMIPAddress waits for the agent of a running guest to report an ip
+// address when wait_for_ip is set.
+func waitForVMIPAddress(ctx context.Context, d *schema.ResourceData, client *hiveClient, guestName string, timeout time.Duration) error {
+	if !d.Get("wait_for_ip").(bool) || d.Get("power_state").(string) != "running" {
+		return nil
+	}
+	log.Printf("[DEBUG] Waiting for guest %s to report an ip address", guestName)
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		var guest *rest.Guest
+		err := client.call(ctx, "GET guest/"+guestName, func(c *rest.Client) (err error) {
+			guest, err = c.GetGuest(guestName)
+			return err
+		})
+		if err != nil {
+			return resource.NonRetryableError(classifyError(err))
+		}
+		if guestIPAddress(guest) == "" {
+			return resource.RetryableError(fmt.Errorf("guest %s has not reported an ip address", guestName))
+		}
+		return nil
+	})
 }
 
 func resourceVMDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	client := m.(*rest.Client)
-	pool, err := client.GetPool(d.Id())
+	client := m.(*hiveClient)
+	var pool *rest.Pool
+	err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+		pool, err = c.GetPool(d.Id())
+		return err
+	})
+	if isNotFound(err) {
+		return diag.Diagnostics{}
+	}
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
-	err = pool.Delete(client)
+	err = client.call(ctx, "DELETE pool/"+d.Id(), func(c *rest.Client) error {
+		return pool.Delete(c)
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	err = resource.RetryContext(ctx, d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
-		pool, err := client.GetPool(d.Id())
+		var pool *rest.Pool
+		err := client.call(ctx, "GET pool/"+d.Id(), func(c *rest.Client) (err error) {
+			pool, err = c.GetPool(d.Id())
+			return err
+		})
 		if err == nil && pool.State == "deleting" {
-			time.Sleep(5 * time.Second)
 			return resource.RetryableError(fmt.Errorf("deleting pool %s", d.Id()))
 		}
-		if err != nil && strings.Contains(err.Error(), "\"error\": 404") {
-			time.Sleep(5 * time.Second)
+		if isNotFound(err) {
 			return nil
 		}
 		if err != nil {
-			return resource.NonRetryableError(err)
+			return resource.NonRetryableError(classifyError(err))
 		}
 		return nil
 	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diagFromErr(err)
 	}
 	return diag.Diagnostics{}
 }
@@ -0,0 +1,312 @@
+package hiveio
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+func TestResourceVM(t *testing.T) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	storage := fake.addStoragePool("vms")
+	fake.addDisk(storage.ID, "ubuntu.qcow2", "qcow2", 20)
+
+	config := func(cpu, memory int) map[string]interface{} {
+		return map[string]interface{}{
+			"name":           "test vm",
+			"cpu":            cpu,
+			"memory":         memory,
+			"os":             "linux",
+			"display_driver": "qxl",
+			"disk": []interface{}{
+				map[string]interface{}{
+					"storage_id": storage.ID,
+					"filename":   "ubuntu.qcow2",
+				},
+			},
+			"interface": []interface{}{
+				map[string]interface{}{
+					"network": "prod",
+					"vlan":    10,
+				},
+			},
+		}
+	}
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_virtual_machine",
+		Steps: []lifecycleStep{
+			{
+				Config: config(2, 2048),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("hiveio_virtual_machine.test", "id"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "disk.0.filename", "ubuntu.qcow2"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.0.vlan", "10"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.0.mac_address", "52:54:00:00:00:00"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.0.ip_address", "10.0.0.10"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "ip_address", "10.0.0.10"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "guest_name", "TEST_VM"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "guest_state", "ready"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "agent_version", "3.2.0"),
+					resource.TestCheckResourceAttrSet("hiveio_virtual_machine.test", "host_id"),
+					func(s *terraform.State) error {
+						if fake.guest("TEST_VM") == nil {
+							return fmt.Errorf("guest TEST_VM was not created")
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config: config(4, 4096),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "cpu", "4"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "memory", "4096"),
+				),
+			},
+		},
+	})
+}
+
+func testVMConfig(storageID string, extra map[string]interface{}) map[string]interface{} {
+	config := map[string]interface{}{
+		"name":   "test vm",
+		"cpu":    2,
+		"memory": 2048,
+		"os":     "linux",
+		"disk": []interface{}{
+			map[string]interface{}{
+				"storage_id": storageID,
+				"filename":   "ubuntu.qcow2",
+			},
+		},
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+	return config
+}
+
+func testVMFake(t *testing.T) (*fakeHive, string) {
+	fake := newFakeHive(t)
+	fake.addHost("10.0.0.11")
+	storage := fake.addStoragePool("vms")
+	fake.addDisk(storage.ID, "ubuntu.qcow2", "qcow2", 20)
+	return fake, storage.ID
+}
+
+func testCheckGuestState(fake *fakeHive, name, state string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		guest := fake.guest(name)
+		if guest == nil {
+			return fmt.Errorf("guest %s not found", name)
+		}
+		if guest.GuestState != state {
+			return fmt.Errorf("guest %s is %s, expected %s", name, guest.GuestState, state)
+		}
+		return nil
+	}
+}
+
+func TestResourceVMPowerState(t *testing.T) {
+	fake, storageID := testVMFake(t)
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_virtual_machine",
+		Steps: []lifecycleStep{
+			{
+				Config: testVMConfig(storageID, map[string]interface{}{"power_state": "stopped"}),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "power_state", "stopped"),
+					testCheckGuestState(fake, "TEST_VM", "stopped"),
+				),
+			},
+			{
+				Config: testVMConfig(storageID, nil),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "power_state", "running"),
+					testCheckGuestState(fake, "TEST_VM", "ready"),
+				),
+			},
+			{
+				// a guest suspended outside of terraform is resumed
+				PreConfig: func() {
+					fake.update(func() { fake.guests["TEST_VM"].GuestState = "paused" })
+				},
+				Config: testVMConfig(storageID, nil),
+				Check:  testCheckGuestState(fake, "TEST_VM", "ready"),
+			},
+			{
+				// a failed guest is read as unknown and powered on
+				PreConfig: func() {
+					fake.update(func() { fake.guests["TEST_VM"].GuestState = "failed" })
+				},
+				Config: testVMConfig(storageID, nil),
+				Check:  testCheckGuestState(fake, "TEST_VM", "ready"),
+			},
+			{
+				Config: testVMConfig(storageID, map[string]interface{}{"reboot_trigger": "1"}),
+				Check: func(*terraform.State) error {
+					if count := fake.requestCount("POST", "guest/TEST_VM/reboot"); count != 1 {
+						return fmt.Errorf("expected 1 reboot, got %d", count)
+					}
+					return nil
+				},
+			},
+			{
+				Config:      testVMConfig(storageID, map[string]interface{}{"power_state": "suspended", "reboot_trigger": "1"}),
+				ExpectError: regexp.MustCompile("can not be suspended"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"reboot_trigger"},
+	})
+}
+
+func TestGuestPowerState(t *testing.T) {
+	for state, expected := range map[string]string{
+		"ready":        "running",
+		"stopped":      "stopped",
+		"paused":       "suspended",
+		"provisioning": "unknown",
+		"failed":       "unknown",
+		"error":        "unknown",
+		"":             "unknown",
+	} {
+		if actual := guestPowerState(&rest.Guest{GuestState: state}); actual != expected {
+			t.Errorf("guest state %q: expected %s, got %s", state, expected, actual)
+		}
+	}
+}
+
+func TestResourceVMPowerOffAfterShutdownTimeout(t *testing.T) {
+	fake, storageID := testVMFake(t)
+	fake.update(func() { fake.ignoreShutdown = true })
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_virtual_machine",
+		Steps: []lifecycleStep{
+			{
+				Config: testVMConfig(storageID, nil),
+			},
+			{
+				Config: testVMConfig(storageID, map[string]interface{}{
+					"power_state":               "stopped",
+					"graceful_shutdown_timeout": 1,
+				}),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckGuestState(fake, "TEST_VM", "stopped"),
+					func(*terraform.State) error {
+						if fake.requestCount("POST", "guest/TEST_VM/shutdown") != 1 || fake.requestCount("POST", "guest/TEST_VM/poweroff") != 1 {
+							return fmt.Errorf("expected a shutdown followed by a power off")
+						}
+						return nil
+					},
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"graceful_shutdown_timeout"},
+	})
+}
+
+func TestResourceVMWaitForIP(t *testing.T) {
+	fake, storageID := testVMFake(t)
+	fake.update(func() { fake.ipDelay = time.Second })
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_virtual_machine",
+		Steps: []lifecycleStep{
+			{
+				Config: testVMConfig(storageID, map[string]interface{}{
+					"wait_for_ip": true,
+					"interface": []interface{}{
+						map[string]interface{}{
+							"network": "prod",
+							"vlan":    10,
+						},
+					},
+				}),
+				Check: resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "ip_address", "10.0.0.10"),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"wait_for_ip"},
+	})
+}
+
+func TestResourceVMDeviceChanges(t *testing.T) {
+	fake, storageID := testVMFake(t)
+	fake.addDisk(storageID, "data.qcow2", "qcow2", 10)
+	disk := func(filename string) interface{} {
+		return map[string]interface{}{"storage_id": storageID, "filename": filename}
+	}
+	nic := func(network string, vlan int) interface{} {
+		return map[string]interface{}{"network": network, "vlan": vlan}
+	}
+	config := func(disks, interfaces []interface{}) map[string]interface{} {
+		return testVMConfig(storageID, map[string]interface{}{"disk": disks, "interface": interfaces})
+	}
+	var id string
+	checkNotReplaced := func(s *terraform.State) error {
+		rs := s.RootModule().Resources["hiveio_virtual_machine.test"].Primary
+		if id == "" {
+			id = rs.ID
+		}
+		if rs.ID != id {
+			return fmt.Errorf("virtual machine was replaced")
+		}
+		return nil
+	}
+
+	testLifecycle(t, fake, lifecycleTest{
+		Resource: "hiveio_virtual_machine",
+		Steps: []lifecycleStep{
+			{
+				Config: config([]interface{}{disk("ubuntu.qcow2"), disk("data.qcow2")}, []interface{}{nic("prod", 10)}),
+				Check:  checkNotReplaced,
+			},
+			{
+				// added and removed devices are hot-plugged
+				Config: config([]interface{}{disk("ubuntu.qcow2")}, []interface{}{nic("prod", 10), nic("backup", 20)}),
+				Check: resource.ComposeTestCheckFunc(
+					checkNotReplaced,
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "disk.#", "1"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.#", "2"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.1.network", "backup"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "pending_reboot", "false"),
+				),
+			},
+			{
+				// an interface removed outside of terraform is added again
+				PreConfig: func() {
+					fake.update(func() {
+						for _, pool := range fake.pools {
+							pool.GuestProfile.Interfaces = pool.GuestProfile.Interfaces[:1]
+						}
+					})
+				},
+				Config: config([]interface{}{disk("ubuntu.qcow2")}, []interface{}{nic("prod", 10), nic("backup", 20)}),
+				Check: resource.ComposeTestCheckFunc(
+					checkNotReplaced,
+					func(*terraform.State) error {
+						if n := len(fake.pool(id).GuestProfile.Interfaces); n != 2 {
+							return fmt.Errorf("pool has %d interfaces", n)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				// reordered interfaces are applied by a reboot
+				Config: config([]interface{}{disk("ubuntu.qcow2")}, []interface{}{nic("backup", 20), nic("prod", 10)}),
+				Check: resource.ComposeTestCheckFunc(
+					checkNotReplaced,
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.0.network", "backup"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "interface.0.mac_address", "52:54:00:00:01:01"),
+					resource.TestCheckResourceAttr("hiveio_virtual_machine.test", "pending_reboot", "true"),
+				),
+			},
+		},
+		ImportStateVerifyIgnore: []string{"pending_reboot"},
+	})
+}
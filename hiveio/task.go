@@ -0,0 +1,77 @@
+package hiveio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hive-io/hive-go-client/rest"
+)
+
+// Polling intervals of waitForTask, the interval doubles while the task runs.
+var (
+	taskPollInterval    = 100 * time.Millisecond
+	maxTaskPollInterval = 10 * time.Second
+)
+
+// taskError is a task that failed on the server.
+type taskError struct {
+	task *rest.Task
+}
+
+func (e *taskError) Error() string {
+	return fmt.Sprintf("task %s failed: %s", e.task.Name, e.task.Message)
+}
+
+// waitForTask polls task until it completes and returns the final record. A
+// failed task is returned as a *taskError. When ctx is done or timeout passes
+// first it stops waiting, the hive api has no endpoint to cancel a task so the
+// task keeps running on the server.
+func waitForTask(ctx context.Context, client *hiveClient, task *rest.Task, timeout time.Duration) (*rest.Task, error) {
+	waitCtx, stop := context.WithTimeout(ctx, timeout)
+	defer stop()
+	log.Printf("[DEBUG] Waiting for task %s (%s)", task.ID, task.Name)
+	interval := taskPollInterval
+	progress := float32(-1)
+	for {
+		switch task.State {
+		case "completed":
+			log.Printf("[DEBUG] Task %s (%s) completed", task.ID, task.Name)
+			return task, nil
+		case "failed", "cancelled":
+			return task, &taskError{task: task}
+		}
+		if task.Progress != progress {
+			progress = task.Progress
+			log.Printf("[INFO] Task %s (%s) is %s, %.0f%% complete", task.ID, task.Name, task.State, task.Progress)
+		}
+
+		select {
+		case <-waitCtx.Done():
+			log.Printf("[WARN] Stopped waiting for task %s (%s), it keeps running on the server", task.ID, task.Name)
+			if errors.Is(waitCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				return task, fmt.Errorf("timeout after %s waiting for task %s at %.0f%%", timeout, task.Name, task.Progress)
+			}
+			return task, fmt.Errorf("stopped waiting for task %s at %.0f%%: %w", task.Name, task.Progress, waitCtx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxTaskPollInterval {
+			interval = maxTaskPollInterval
+		}
+
+		var current *rest.Task
+		err := client.call(waitCtx, "GET task/"+task.ID, func(c *rest.Client) (err error) {
+			current, err = c.GetTask(task.ID)
+			return err
+		})
+		if err != nil && waitCtx.Err() == nil {
+			return task, err
+		}
+		if err == nil {
+			task = current
+		}
+	}
+}
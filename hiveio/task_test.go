@@ -0,0 +1,70 @@
+package hiveio
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+func TestWaitForTaskFailed(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	r := resourceDisk()
+	d := r.TestResourceData()
+	d.Set("storage_pool", storage.ID)
+	d.Set("filename", "missing.qcow2")
+	d.Set("src_url", "https://images.example.com/missing.qcow2")
+	diags := r.CreateContext(context.Background(), d, testClient(t, fake))
+	if len(diags) != 1 || diags[0].Severity != diag.Error {
+		t.Fatalf("expected one error, got %v", diags)
+	}
+	if diags[0].Summary != "Task copy url failed" || !regexp.MustCompile("404 Not Found").MatchString(diags[0].Detail) {
+		t.Fatalf("expected the task message as detail, got %q: %q", diags[0].Summary, diags[0].Detail)
+	}
+}
+
+func TestWaitForTaskInterrupted(t *testing.T) {
+	fake := newFakeHive(t)
+	storage := fake.addStoragePool("vms")
+	fake.update(func() { fake.taskDuration = time.Hour })
+	client := testClient(t, fake)
+
+	r := resourceDisk()
+	d := r.TestResourceData()
+	d.Set("storage_pool", storage.ID)
+	d.Set("filename", "cloud.qcow2")
+	d.Set("src_url", "https://images.example.com/cloud.qcow2")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	diags := r.CreateContext(ctx, d, client)
+	if err := diagsError(diags); err == nil || !regexp.MustCompile("stopped waiting for task copy url").MatchString(err.Error()) {
+		t.Fatalf("expected the wait to be interrupted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("create returned %s after the context was cancelled", elapsed)
+	}
+
+	// the hive api has no endpoint to cancel a task, only its state is read
+	var states, requests []string
+	fake.update(func() {
+		for _, task := range fake.tasks {
+			states = append(states, task.State)
+		}
+		for _, r := range fake.requests {
+			if strings.Contains(r, " task/") && !strings.HasPrefix(r, "GET ") {
+				requests = append(requests, r)
+			}
+		}
+	})
+	if len(states) != 1 || states[0] != "running" {
+		t.Fatalf("expected the copy to keep running on the server, tasks are %v", states)
+	}
+	if len(requests) > 0 {
+		t.Fatalf("expected only task reads, got %v", requests)
+	}
+}
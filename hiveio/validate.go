@@ -0,0 +1,34 @@
+package hiveio
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// Values accepted by the hive api for enum arguments. Disk types are matched
+// case insensitively because the api accepts both Disk and disk.
+var (
+	firmwareTypes   = []string{"uefi", "bios"}
+	displayDrivers  = []string{"cirrus", "qxl", "vga", "virtio"}
+	diskTypes       = []string{"Disk", "CDROM"}
+	diskDrivers     = []string{"virtio", "ide", "scsi", "sata"}
+	diskFormats     = []string{"qcow2", "raw"}
+	nicEmulations   = []string{"virtio", "e1000", "rtl8139"}
+	storageTypes    = []string{"nfs", "cifs", "s3", "azure", "ftp", "sftp", "http", "https"}
+	storageRoles    = []string{"guest", "template", "iso", "backup", "userVolume"}
+	userRoles       = []string{"readonly", "admin"}
+	hostStates      = []string{"available", "maintenance", "broker"}
+	backupFrequency = []string{"daily", "weekly", "monthly"}
+	// poolStorageTypes are local disk, ram, shared storage and the types of
+	// storage pools.
+	poolStorageTypes = append([]string{"disk", "ram", "gluster"}, storageTypes...)
+)
+
+// diffIsSet reports whether key has a value in a planned diff. Values that are
+// not known yet are counted as set.
+func diffIsSet(d *schema.ResourceDiff, key string) bool {
+	if !d.NewValueKnown(key) {
+		return true
+	}
+	_, ok := d.GetOk(key)
+	return ok
+}